@@ -0,0 +1,29 @@
+// Package sample has a struct with every field type codecgen supports, its
+// generated codecs are checked against encoding/json and msgpack.
+package sample
+
+import "time"
+
+//go:generate go run benchmark/cmd/codecgen -type Sample
+
+type Sample struct {
+	Inner
+
+	Int    int       `json:"int" msgpack:"int"`
+	Int8   int8      `json:"int8,omitempty" msgpack:"int8,omitempty"`
+	Int16  int16     `json:"int16,omitempty" msgpack:"int16,omitempty"`
+	Int32  int32     `json:"int32,omitempty" msgpack:"int32,omitempty"`
+	Uint   uint      `json:"uint,omitempty" msgpack:"uint,omitempty"`
+	Uint8  uint8     `json:"uint8,omitempty" msgpack:"uint8,omitempty"`
+	Uint16 uint16    `json:"uint16,omitempty" msgpack:"uint16,omitempty"`
+	Uint64 uint64    `json:"uint64" msgpack:"uint64"`
+	Bool   bool      `json:"bool,omitempty" msgpack:"bool,omitempty"`
+	Name   string    `json:"name,omitempty" msgpack:"name,omitempty"`
+	Data   []byte    `json:"data,omitempty" msgpack:"data,omitempty"`
+	Time   time.Time `json:"time,omitempty" msgpack:"time,omitempty"`
+	Skip   int       `json:"-" msgpack:"-"`
+}
+
+type Inner struct {
+	Int64 int64 `json:"int64,omitempty" msgpack:"int64,omitempty"`
+}
@@ -0,0 +1,387 @@
+// Code generated by codecgen -type Sample; DO NOT EDIT.
+
+package sample
+
+import "benchmark/pack/codec"
+
+// SampleJSON encodes Sample as encoding/json does, without reflection.
+var SampleJSON SampleJSONCodec
+
+// SampleJSONCodec limits the input of Decode and DecodeSlice to its MaxFrameSize.
+type SampleJSONCodec struct {
+	codec.Limits
+}
+
+func (c SampleJSONCodec) Encode(p *Sample) []byte {
+	return c.Append(make([]byte, 0, c.size(p)), p)
+}
+
+func (SampleJSONCodec) size(p *Sample) int {
+	return 349 + len(p.Name) + len(p.Data)*4/3
+}
+
+func (SampleJSONCodec) Append(b []byte, p *Sample) []byte {
+	start := len(b)
+	if p.Inner.Int64 != 0 {
+		b = append(b, `,"int64":`...)
+		b = codec.AppendJSONInt(b, int64(p.Inner.Int64))
+	}
+	b = append(b, `,"int":`...)
+	b = codec.AppendJSONInt(b, int64(p.Int))
+	if p.Int8 != 0 {
+		b = append(b, `,"int8":`...)
+		b = codec.AppendJSONInt(b, int64(p.Int8))
+	}
+	if p.Int16 != 0 {
+		b = append(b, `,"int16":`...)
+		b = codec.AppendJSONInt(b, int64(p.Int16))
+	}
+	if p.Int32 != 0 {
+		b = append(b, `,"int32":`...)
+		b = codec.AppendJSONInt(b, int64(p.Int32))
+	}
+	if p.Uint != 0 {
+		b = append(b, `,"uint":`...)
+		b = codec.AppendJSONUint(b, uint64(p.Uint))
+	}
+	if p.Uint8 != 0 {
+		b = append(b, `,"uint8":`...)
+		b = codec.AppendJSONUint(b, uint64(p.Uint8))
+	}
+	if p.Uint16 != 0 {
+		b = append(b, `,"uint16":`...)
+		b = codec.AppendJSONUint(b, uint64(p.Uint16))
+	}
+	b = append(b, `,"uint64":`...)
+	b = codec.AppendJSONUint(b, uint64(p.Uint64))
+	if p.Bool {
+		b = append(b, `,"bool":`...)
+		b = codec.AppendJSONBool(b, p.Bool)
+	}
+	if len(p.Name) != 0 {
+		b = append(b, `,"name":`...)
+		b = codec.AppendJSONString(b, p.Name)
+	}
+	if len(p.Data) != 0 {
+		b = append(b, `,"data":`...)
+		b = codec.AppendJSONBytes(b, p.Data)
+	}
+	b = append(b, `,"time":`...)
+	b = codec.AppendJSONTime(b, p.Time)
+	if len(b) == start {
+		b = append(b, '{')
+	} else {
+		b[start] = '{'
+	}
+	return append(b, '}')
+}
+
+// EncodeSlice encodes ps as a JSON array, nil as null.
+func (c SampleJSONCodec) EncodeSlice(ps []Sample) []byte {
+	n := 2
+	for i := range ps {
+		n += c.size(&ps[i]) + 1
+	}
+	return c.AppendSlice(make([]byte, 0, n), ps)
+}
+
+func (c SampleJSONCodec) AppendSlice(b []byte, ps []Sample) []byte {
+	if ps == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i := range ps {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = c.Append(b, &ps[i])
+	}
+	return append(b, ']')
+}
+
+func (c SampleJSONCodec) Decode(data []byte, p *Sample) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	return c.decode(data, p)
+}
+
+// DecodeSlice decodes a JSON array into ps, null into nil.
+func (c SampleJSONCodec) DecodeSlice(data []byte, ps *[]Sample) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	var r codec.JSONReader
+	r.Reset(data)
+	if r.Null() {
+		*ps = nil
+		return r.End()
+	}
+	*ps = (*ps)[:0]
+	if *ps == nil {
+		*ps = []Sample{}
+	}
+	for r.NextElement() {
+		raw := r.Raw()
+		if r.Err() != nil {
+			break
+		}
+		*ps = append(*ps, Sample{})
+		if err := c.decode(raw, &(*ps)[len(*ps)-1]); err != nil {
+			return err
+		}
+	}
+	return r.End()
+}
+
+func (SampleJSONCodec) decode(data []byte, p *Sample) error {
+	var r codec.JSONReader
+	r.Reset(data)
+	for r.NextField() {
+		switch string(r.Key()) {
+		case "int64":
+			if !r.Null() {
+				p.Inner.Int64 = int64(r.Int(64))
+			}
+		case "int":
+			if !r.Null() {
+				p.Int = int(r.Int(0))
+			}
+		case "int8":
+			if !r.Null() {
+				p.Int8 = int8(r.Int(8))
+			}
+		case "int16":
+			if !r.Null() {
+				p.Int16 = int16(r.Int(16))
+			}
+		case "int32":
+			if !r.Null() {
+				p.Int32 = int32(r.Int(32))
+			}
+		case "uint":
+			if !r.Null() {
+				p.Uint = uint(r.Uint(0))
+			}
+		case "uint8":
+			if !r.Null() {
+				p.Uint8 = uint8(r.Uint(8))
+			}
+		case "uint16":
+			if !r.Null() {
+				p.Uint16 = uint16(r.Uint(16))
+			}
+		case "uint64":
+			if !r.Null() {
+				p.Uint64 = uint64(r.Uint(64))
+			}
+		case "bool":
+			if !r.Null() {
+				p.Bool = r.Bool()
+			}
+		case "name":
+			if !r.Null() {
+				p.Name = r.String()
+			}
+		case "data":
+			if r.Null() {
+				p.Data = nil
+			} else {
+				p.Data = r.Bytes()
+			}
+		case "time":
+			if !r.Null() {
+				p.Time = r.Time()
+			}
+		default:
+			r.Skip()
+		}
+	}
+	return r.End()
+}
+
+// SampleMsgpack encodes Sample as github.com/vmihailenco/msgpack does,
+// without reflection.
+var SampleMsgpack SampleMsgpackCodec
+
+// SampleMsgpackCodec limits the input of Decode and DecodeSlice to its MaxFrameSize.
+type SampleMsgpackCodec struct {
+	codec.Limits
+}
+
+func (c SampleMsgpackCodec) Encode(p *Sample) []byte {
+	return c.Append(make([]byte, 0, c.size(p)), p)
+}
+
+func (SampleMsgpackCodec) size(p *Sample) int {
+	return 349 + len(p.Name) + len(p.Data)
+}
+
+func (SampleMsgpackCodec) Append(b []byte, p *Sample) []byte {
+	n := 3
+	if p.Inner.Int64 != 0 {
+		n++
+	}
+	if p.Int8 != 0 {
+		n++
+	}
+	if p.Int16 != 0 {
+		n++
+	}
+	if p.Int32 != 0 {
+		n++
+	}
+	if p.Uint != 0 {
+		n++
+	}
+	if p.Uint8 != 0 {
+		n++
+	}
+	if p.Uint16 != 0 {
+		n++
+	}
+	if p.Bool {
+		n++
+	}
+	if len(p.Name) != 0 {
+		n++
+	}
+	if len(p.Data) != 0 {
+		n++
+	}
+	b = codec.AppendMsgpackMapLen(b, n)
+	if p.Inner.Int64 != 0 {
+		b = append(b, "\xa5int64"...)
+		b = codec.AppendMsgpackIntN(b, int64(p.Inner.Int64), 64)
+	}
+	b = append(b, "\xa3int"...)
+	b = codec.AppendMsgpackIntN(b, int64(p.Int), 0)
+	if p.Int8 != 0 {
+		b = append(b, "\xa4int8"...)
+		b = codec.AppendMsgpackIntN(b, int64(p.Int8), 8)
+	}
+	if p.Int16 != 0 {
+		b = append(b, "\xa5int16"...)
+		b = codec.AppendMsgpackIntN(b, int64(p.Int16), 16)
+	}
+	if p.Int32 != 0 {
+		b = append(b, "\xa5int32"...)
+		b = codec.AppendMsgpackIntN(b, int64(p.Int32), 32)
+	}
+	if p.Uint != 0 {
+		b = append(b, "\xa4uint"...)
+		b = codec.AppendMsgpackUintN(b, uint64(p.Uint), 0)
+	}
+	if p.Uint8 != 0 {
+		b = append(b, "\xa5uint8"...)
+		b = codec.AppendMsgpackUintN(b, uint64(p.Uint8), 8)
+	}
+	if p.Uint16 != 0 {
+		b = append(b, "\xa6uint16"...)
+		b = codec.AppendMsgpackUintN(b, uint64(p.Uint16), 16)
+	}
+	b = append(b, "\xa6uint64"...)
+	b = codec.AppendMsgpackUintN(b, uint64(p.Uint64), 64)
+	if p.Bool {
+		b = append(b, "\xa4bool"...)
+		b = codec.AppendMsgpackBool(b, p.Bool)
+	}
+	if len(p.Name) != 0 {
+		b = append(b, "\xa4name"...)
+		b = codec.AppendMsgpackString(b, p.Name)
+	}
+	if len(p.Data) != 0 {
+		b = append(b, "\xa4data"...)
+		b = codec.AppendMsgpackBytes(b, p.Data)
+	}
+	b = append(b, "\xa4time"...)
+	b = codec.AppendMsgpackTime(b, p.Time)
+	return b
+}
+
+// EncodeSlice encodes ps as an array, nil as nil.
+func (c SampleMsgpackCodec) EncodeSlice(ps []Sample) []byte {
+	n := 5
+	for i := range ps {
+		n += c.size(&ps[i])
+	}
+	return c.AppendSlice(make([]byte, 0, n), ps)
+}
+
+func (c SampleMsgpackCodec) AppendSlice(b []byte, ps []Sample) []byte {
+	if ps == nil {
+		return codec.AppendMsgpackNil(b)
+	}
+	b = codec.AppendMsgpackArrayLen(b, len(ps))
+	for i := range ps {
+		b = c.Append(b, &ps[i])
+	}
+	return b
+}
+
+func (c SampleMsgpackCodec) Decode(data []byte, p *Sample) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	var r codec.MsgpackReader
+	r.Reset(data)
+	c.decode(&r, p)
+	return r.End()
+}
+
+// DecodeSlice decodes an array into ps, nil into nil.
+func (c SampleMsgpackCodec) DecodeSlice(data []byte, ps *[]Sample) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	var r codec.MsgpackReader
+	r.Reset(data)
+	if r.Nil() {
+		*ps = nil
+		return r.End()
+	}
+	*ps = (*ps)[:0]
+	if *ps == nil {
+		*ps = []Sample{}
+	}
+	for n := r.ArrayLen(); n > 0 && r.Err() == nil; n-- {
+		*ps = append(*ps, Sample{})
+		c.decode(&r, &(*ps)[len(*ps)-1])
+	}
+	return r.End()
+}
+
+func (SampleMsgpackCodec) decode(r *codec.MsgpackReader, p *Sample) {
+	for n := r.MapLen(); n > 0 && r.Err() == nil; n-- {
+		switch string(r.Key()) {
+		case "int64":
+			p.Inner.Int64 = int64(r.Int(64))
+		case "int":
+			p.Int = int(r.Int(0))
+		case "int8":
+			p.Int8 = int8(r.Int(8))
+		case "int16":
+			p.Int16 = int16(r.Int(16))
+		case "int32":
+			p.Int32 = int32(r.Int(32))
+		case "uint":
+			p.Uint = uint(r.Uint(0))
+		case "uint8":
+			p.Uint8 = uint8(r.Uint(8))
+		case "uint16":
+			p.Uint16 = uint16(r.Uint(16))
+		case "uint64":
+			p.Uint64 = uint64(r.Uint(64))
+		case "bool":
+			p.Bool = r.Bool()
+		case "name":
+			p.Name = r.String()
+		case "data":
+			p.Data = r.Bytes()
+		case "time":
+			p.Time = r.Time()
+		default:
+			r.Skip()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sample
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+)
+
+var samples = []Sample{
+	{},
+	{Int: -1, Uint64: 1, Name: "name"},
+	{
+		Inner: Inner{Int64: -1 << 40},
+		Int:   1 << 40, Int8: -8, Int16: -1 << 12, Int32: 1 << 20,
+		Uint: 1 << 40, Uint8: 200, Uint16: 1 << 15, Uint64: 1 << 63,
+		Bool: true, Name: "\"<sample>\"\n", Data: []byte{0, 1, 2},
+		Time: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+	},
+}
+
+func TestSampleJSON(t *testing.T) {
+	for _, s := range samples {
+		want, err := json.Marshal(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(want), string(SampleJSON.Encode(&s)), "encoding differs from encoding/json")
+
+		var got Sample
+		assert.NoError(t, SampleJSON.Decode(want, &got), "decode failed")
+		s.Skip = 0
+		assert.Equal(t, s, got, "invalid sample")
+	}
+}
+
+func TestSampleMsgpack(t *testing.T) {
+	for _, s := range samples {
+		want, err := msgpack.Marshal(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, SampleMsgpack.Encode(&s), "encoding differs from msgpack")
+
+		var got Sample
+		assert.NoError(t, SampleMsgpack.Decode(want, &got), "decode failed")
+		s.Skip = 0
+		// msgpack decodes times in the local zone.
+		assert.True(t, s.Time.Equal(got.Time), "invalid time")
+		got.Time = s.Time
+		assert.Equal(t, s, got, "invalid sample")
+	}
+
+	want, err := msgpack.Marshal(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want, SampleMsgpack.EncodeSlice(samples), "slice encoding differs from msgpack")
+}
@@ -0,0 +1,523 @@
+// Codecgen generates reflection-free JSON and msgpack codecs for structs, so
+// they can be compared with and used instead of encoding/json and
+// github.com/vmihailenco/msgpack.
+//
+// For a type T it writes the codecs TJSON and TMsgpack, with the same
+// Encode/Append/Decode methods as the hand-written ones in package pack, and
+// EncodeSlice/AppendSlice/DecodeSlice for []T as an array:
+//
+//	//go:generate go run benchmark/cmd/codecgen -type CapturePacket
+//
+// Fields follow the json and msgpack tags (name, "-" and omitempty), and
+// untagged embedded structs of the same package are inlined. Supported field
+// types are bool, string, []byte, time.Time and the integer types. The
+// output is byte for byte the one of encoding/json and msgpack, integers
+// included, which msgpack writes in the size of their type.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const codecImport = "benchmark/pack/codec"
+
+type field struct {
+	path string // selector from the struct value, e.g. "CaptureInfo.Timestamp"
+	typ  string // Go type name, "[]byte" or "time.Time"
+	kind string // int, uint, bool, string, bytes or time
+	bits int    // integer size, 0 for int and uint
+
+	jsonName, msgpackName           string
+	jsonOmitEmpty, msgpackOmitEmpty bool
+}
+
+var intKinds = map[string]struct {
+	kind string
+	bits int
+}{
+	"int": {"int", 0}, "int8": {"int", 8}, "int16": {"int", 16}, "int32": {"int", 32}, "int64": {"int", 64},
+	"uint": {"uint", 0}, "uint8": {"uint", 8}, "uint16": {"uint", 16}, "uint32": {"uint", 32}, "uint64": {"uint", 64},
+	"byte": {"uint", 8},
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("codecgen: ")
+
+	typeNames := flag.String("type", "", "comma-separated list of struct type names")
+	output := flag.String("output", "", "output file name, default <type>_codec.go")
+	dir := flag.String("dir", ".", "package directory")
+	flag.Parse()
+
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	types := strings.Split(*typeNames, ",")
+
+	src, err := Generate(*dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = snakeCase(types[0]) + "_codec.go"
+	}
+	err = os.WriteFile(filepath.Join(*dir, name), src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Generate returns the formatted source of the codecs of types in dir.
+func Generate(dir string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+	structs := make(map[string]*ast.StructType)
+	for _, f := range pkg.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs[ts.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+
+	g := &generator{}
+	g.printf("// Code generated by codecgen -type %s; DO NOT EDIT.\n\n", strings.Join(types, ","))
+	g.printf("package %s\n\nimport %q\n", pkg.Name, codecImport)
+	for _, name := range types {
+		st, ok := structs[name]
+		if !ok {
+			return nil, fmt.Errorf("struct type %s not found", name)
+		}
+		fields, err := collectFields(structs, st, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		g.genJSON(name, fields)
+		g.genMsgpack(name, fields)
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v", err)
+	}
+	return src, nil
+}
+
+func collectFields(structs map[string]*ast.StructType, st *ast.StructType, prefix string) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			tag, _ = strconv.Unquote(f.Tag.Value)
+		}
+		jsonTag := reflect.StructTag(tag).Get("json")
+		msgpackTag := reflect.StructTag(tag).Get("msgpack")
+
+		if len(f.Names) == 0 {
+			ident, ok := f.Type.(*ast.Ident)
+			if !ok || structs[ident.Name] == nil {
+				return nil, fmt.Errorf("unsupported embedded field %s", exprString(f.Type))
+			}
+			if jsonTag != "" || msgpackTag != "" {
+				return nil, fmt.Errorf("tagged embedded field %s is not supported", ident.Name)
+			}
+			inner, err := collectFields(structs, structs[ident.Name], prefix+ident.Name+".")
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, inner...)
+			continue
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			fd := field{path: prefix + name.Name, typ: exprString(f.Type)}
+			switch fd.typ {
+			case "bool", "string":
+				fd.kind = fd.typ
+			case "[]byte", "[]uint8":
+				fd.kind = "bytes"
+			case "time.Time":
+				fd.kind = "time"
+			default:
+				k, ok := intKinds[fd.typ]
+				if !ok {
+					return nil, fmt.Errorf("unsupported type %s of field %s", fd.typ, name.Name)
+				}
+				fd.kind, fd.bits = k.kind, k.bits
+			}
+
+			fd.jsonName, fd.jsonOmitEmpty = parseTag(jsonTag, name.Name)
+			fd.msgpackName, fd.msgpackOmitEmpty = parseTag(msgpackTag, name.Name)
+			fields = append(fields, fd)
+		}
+	}
+	return fields, nil
+}
+
+func parseTag(tag, fieldName string) (string, bool) {
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = fieldName
+	}
+	omitEmpty := false
+	for _, opt := range strings.Split(opts, ",") {
+		omitEmpty = omitEmpty || opt == "omitempty"
+	}
+	return name, omitEmpty
+}
+
+func exprString(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.ArrayType:
+		if e.Len == nil {
+			return "[]" + exprString(e.Elt)
+		}
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// omitCond is the condition for writing a omitempty field.
+func omitCond(f field) string {
+	v := "p." + f.path
+	switch f.kind {
+	case "int", "uint":
+		return v + " != 0"
+	case "bool":
+		return v
+	case "string", "bytes":
+		return "len(" + v + ") != 0"
+	}
+	return "true"
+}
+
+// sizeHint estimates the encoded size to avoid growing the buffer, base64
+// tells whether bytes are encoded in base64.
+func sizeHint(fields []field, names func(field) string, base64 bool) string {
+	n := 16
+	var dyn []string
+	for _, f := range fields {
+		if names(f) == "-" {
+			continue
+		}
+		n += len(names(f)) + 4
+		switch f.kind {
+		case "int", "uint":
+			n += 20
+		case "bool":
+			n += 5
+		case "time":
+			n += 37
+		case "string":
+			dyn = append(dyn, "len(p."+f.path+")")
+		case "bytes":
+			if base64 {
+				dyn = append(dyn, "len(p."+f.path+")*4/3")
+			} else {
+				dyn = append(dyn, "len(p."+f.path+")")
+			}
+		}
+	}
+	return strings.Join(append([]string{strconv.Itoa(n)}, dyn...), "+")
+}
+
+func (g *generator) genJSON(name string, fields []field) {
+	codec := name + "JSONCodec"
+	g.printf("\n// %sJSON encodes %s as encoding/json does, without reflection.\n", name, name)
+	g.printf("var %sJSON %s\n\n", name, codec)
+	g.printf("// %s limits the input of Decode and DecodeSlice to its MaxFrameSize.\n", codec)
+	g.printf("type %s struct {\ncodec.Limits\n}\n\n", codec)
+
+	g.printf("func (c %s) Encode(p *%s) []byte {\n", codec, name)
+	g.printf("return c.Append(make([]byte, 0, c.size(p)), p)\n}\n\n")
+	g.printf("func (%s) size(p *%s) int {\n", codec, name)
+	g.printf("return %s\n}\n\n", sizeHint(fields, func(f field) string { return f.jsonName }, true))
+
+	// Every field starts with a comma, the first one is turned into '{'.
+	g.printf("func (%s) Append(b []byte, p *%s) []byte {\n", codec, name)
+	g.printf("start := len(b)\n")
+	for _, f := range fields {
+		if f.jsonName == "-" {
+			continue
+		}
+		if f.jsonOmitEmpty && f.kind != "time" {
+			g.printf("if %s {\n", omitCond(f))
+		}
+		g.printf("b = append(b, `,%s:`...)\n", jsonKey(f.jsonName))
+		v := "p." + f.path
+		switch f.kind {
+		case "int":
+			g.printf("b = codec.AppendJSONInt(b, int64(%s))\n", v)
+		case "uint":
+			g.printf("b = codec.AppendJSONUint(b, uint64(%s))\n", v)
+		case "bool":
+			g.printf("b = codec.AppendJSONBool(b, %s)\n", v)
+		case "string":
+			g.printf("b = codec.AppendJSONString(b, %s)\n", v)
+		case "bytes":
+			g.printf("b = codec.AppendJSONBytes(b, %s)\n", v)
+		case "time":
+			g.printf("b = codec.AppendJSONTime(b, %s)\n", v)
+		}
+		if f.jsonOmitEmpty && f.kind != "time" {
+			g.printf("}\n")
+		}
+	}
+	g.printf("if len(b) == start {\nb = append(b, '{')\n} else {\nb[start] = '{'\n}\n")
+	g.printf("return append(b, '}')\n}\n\n")
+
+	g.genSliceEncode(codec, name, "a JSON array, nil as null", "2", "+1")
+	g.printf("func (c %s) AppendSlice(b []byte, ps []%s) []byte {\n", codec, name)
+	g.printf("if ps == nil {\nreturn append(b, \"null\"...)\n}\n")
+	g.printf("b = append(b, '[')\nfor i := range ps {\nif i > 0 {\nb = append(b, ',')\n}\nb = c.Append(b, &ps[i])\n}\n")
+	g.printf("return append(b, ']')\n}\n\n")
+
+	g.printf("func (c %s) Decode(data []byte, p *%s) error {\n", codec, name)
+	g.printf("if err := c.CheckFrame(len(data)); err != nil {\nreturn err\n}\n")
+	g.printf("return c.decode(data, p)\n}\n\n")
+
+	g.printf("// DecodeSlice decodes a JSON array into ps, null into nil.\n")
+	g.printf("func (c %s) DecodeSlice(data []byte, ps *[]%s) error {\n", codec, name)
+	g.printf("if err := c.CheckFrame(len(data)); err != nil {\nreturn err\n}\n")
+	g.printf("var r codec.JSONReader\nr.Reset(data)\n")
+	g.printf("if r.Null() {\n*ps = nil\nreturn r.End()\n}\n")
+	g.printf("*ps = (*ps)[:0]\nif *ps == nil {\n*ps = []%s{}\n}\n", name)
+	g.printf("for r.NextElement() {\nraw := r.Raw()\nif r.Err() != nil {\nbreak\n}\n")
+	g.printf("*ps = append(*ps, %s{})\n", name)
+	g.printf("if err := c.decode(raw, &(*ps)[len(*ps)-1]); err != nil {\nreturn err\n}\n}\nreturn r.End()\n}\n\n")
+
+	g.printf("func (%s) decode(data []byte, p *%s) error {\n", codec, name)
+	g.printf("var r codec.JSONReader\nr.Reset(data)\n")
+	g.printf("for r.NextField() {\nswitch string(r.Key()) {\n")
+	for _, f := range fields {
+		if f.jsonName == "-" {
+			continue
+		}
+		v := "p." + f.path
+		g.printf("case %q:\n", f.jsonName)
+		if f.kind == "bytes" {
+			g.printf("if r.Null() {\n%s = nil\n} else {\n%s = r.Bytes()\n}\n", v, v)
+			continue
+		}
+		g.printf("if !r.Null() {\n")
+		switch f.kind {
+		case "int":
+			g.printf("%s = %s(r.Int(%d))\n", v, f.typ, f.bits)
+		case "uint":
+			g.printf("%s = %s(r.Uint(%d))\n", v, f.typ, f.bits)
+		case "bool":
+			g.printf("%s = r.Bool()\n", v)
+		case "string":
+			g.printf("%s = r.String()\n", v)
+		case "time":
+			g.printf("%s = r.Time()\n", v)
+		}
+		g.printf("}\n")
+	}
+	g.printf("default:\nr.Skip()\n}\n}\nreturn r.End()\n}\n")
+}
+
+// genSliceEncode writes EncodeSlice, with the buffer sized from the elements
+// plus the array header and separators.
+func (g *generator) genSliceEncode(codec, name, what, header, sep string) {
+	g.printf("// EncodeSlice encodes ps as %s.\n", what)
+	g.printf("func (c %s) EncodeSlice(ps []%s) []byte {\n", codec, name)
+	g.printf("n := %s\nfor i := range ps {\nn += c.size(&ps[i])%s\n}\n", header, sep)
+	g.printf("return c.AppendSlice(make([]byte, 0, n), ps)\n}\n\n")
+}
+
+// jsonKey quotes a key for a Go raw string literal.
+func jsonKey(name string) string {
+	b := []byte{'"'}
+	for _, r := range name {
+		if r < 0x20 || r == '"' || r == '\\' || r == '`' || r == '<' || r == '>' || r == '&' {
+			b = append(b, fmt.Sprintf(`\u%04x`, r)...)
+			continue
+		}
+		b = append(b, string(r)...)
+	}
+	return string(append(b, '"'))
+}
+
+func msgpackKey(name string) string {
+	var b []byte
+	switch n := len(name); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n < 256:
+		b = append(b, 0xd9, byte(n))
+	default:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	}
+	return strconv.Quote(string(append(b, name...)))
+}
+
+func (g *generator) genMsgpack(name string, fields []field) {
+	codec := name + "MsgpackCodec"
+	g.printf("\n// %sMsgpack encodes %s as github.com/vmihailenco/msgpack does,\n// without reflection.\n", name, name)
+	g.printf("var %sMsgpack %s\n\n", name, codec)
+	g.printf("// %s limits the input of Decode and DecodeSlice to its MaxFrameSize.\n", codec)
+	g.printf("type %s struct {\ncodec.Limits\n}\n\n", codec)
+
+	g.printf("func (c %s) Encode(p *%s) []byte {\n", codec, name)
+	g.printf("return c.Append(make([]byte, 0, c.size(p)), p)\n}\n\n")
+	g.printf("func (%s) size(p *%s) int {\n", codec, name)
+	g.printf("return %s\n}\n\n", sizeHint(fields, func(f field) string { return f.msgpackName }, false))
+
+	var encoded []field
+	omitEmpty := false
+	for _, f := range fields {
+		if f.msgpackName != "-" {
+			encoded = append(encoded, f)
+			omitEmpty = omitEmpty || (f.msgpackOmitEmpty && f.kind != "time")
+		}
+	}
+
+	g.printf("func (%s) Append(b []byte, p *%s) []byte {\n", codec, name)
+	if omitEmpty {
+		// The fields are counted first for the smallest map header.
+		always := 0
+		for _, f := range encoded {
+			if !f.msgpackOmitEmpty || f.kind == "time" {
+				always++
+			}
+		}
+		g.printf("n := %d\n", always)
+		for _, f := range encoded {
+			if f.msgpackOmitEmpty && f.kind != "time" {
+				g.printf("if %s {\nn++\n}\n", omitCond(f))
+			}
+		}
+		g.printf("b = codec.AppendMsgpackMapLen(b, n)\n")
+	} else {
+		g.printf("b = codec.AppendMsgpackMapLen(b, %d)\n", len(encoded))
+	}
+	for _, f := range encoded {
+		omit := f.msgpackOmitEmpty && f.kind != "time"
+		if omit {
+			g.printf("if %s {\n", omitCond(f))
+		}
+		g.printf("b = append(b, %s...)\n", msgpackKey(f.msgpackName))
+		v := "p." + f.path
+		switch f.kind {
+		case "int":
+			g.printf("b = codec.AppendMsgpackIntN(b, int64(%s), %d)\n", v, f.bits)
+		case "uint":
+			g.printf("b = codec.AppendMsgpackUintN(b, uint64(%s), %d)\n", v, f.bits)
+		case "bool":
+			g.printf("b = codec.AppendMsgpackBool(b, %s)\n", v)
+		case "string":
+			g.printf("b = codec.AppendMsgpackString(b, %s)\n", v)
+		case "bytes":
+			g.printf("b = codec.AppendMsgpackBytes(b, %s)\n", v)
+		case "time":
+			g.printf("b = codec.AppendMsgpackTime(b, %s)\n", v)
+		}
+		if omit {
+			g.printf("}\n")
+		}
+	}
+	g.printf("return b\n}\n\n")
+
+	g.genSliceEncode(codec, name, "an array, nil as nil", "5", "")
+	g.printf("func (c %s) AppendSlice(b []byte, ps []%s) []byte {\n", codec, name)
+	g.printf("if ps == nil {\nreturn codec.AppendMsgpackNil(b)\n}\n")
+	g.printf("b = codec.AppendMsgpackArrayLen(b, len(ps))\nfor i := range ps {\nb = c.Append(b, &ps[i])\n}\nreturn b\n}\n\n")
+
+	g.printf("func (c %s) Decode(data []byte, p *%s) error {\n", codec, name)
+	g.printf("if err := c.CheckFrame(len(data)); err != nil {\nreturn err\n}\n")
+	g.printf("var r codec.MsgpackReader\nr.Reset(data)\nc.decode(&r, p)\nreturn r.End()\n}\n\n")
+
+	g.printf("// DecodeSlice decodes an array into ps, nil into nil.\n")
+	g.printf("func (c %s) DecodeSlice(data []byte, ps *[]%s) error {\n", codec, name)
+	g.printf("if err := c.CheckFrame(len(data)); err != nil {\nreturn err\n}\n")
+	g.printf("var r codec.MsgpackReader\nr.Reset(data)\n")
+	g.printf("if r.Nil() {\n*ps = nil\nreturn r.End()\n}\n")
+	g.printf("*ps = (*ps)[:0]\nif *ps == nil {\n*ps = []%s{}\n}\n", name)
+	g.printf("for n := r.ArrayLen(); n > 0 && r.Err() == nil; n-- {\n")
+	g.printf("*ps = append(*ps, %s{})\nc.decode(&r, &(*ps)[len(*ps)-1])\n}\nreturn r.End()\n}\n\n", name)
+
+	g.printf("func (%s) decode(r *codec.MsgpackReader, p *%s) {\n", codec, name)
+	g.printf("for n := r.MapLen(); n > 0 && r.Err() == nil; n-- {\nswitch string(r.Key()) {\n")
+	for _, f := range encoded {
+		v := "p." + f.path
+		g.printf("case %q:\n", f.msgpackName)
+		switch f.kind {
+		case "int":
+			g.printf("%s = %s(r.Int(%d))\n", v, f.typ, f.bits)
+		case "uint":
+			g.printf("%s = %s(r.Uint(%d))\n", v, f.typ, f.bits)
+		case "bool":
+			g.printf("%s = r.Bool()\n", v)
+		case "string":
+			g.printf("%s = r.String()\n", v)
+		case "bytes":
+			g.printf("%s = r.Bytes()\n", v)
+		case "time":
+			g.printf("%s = r.Time()\n", v)
+		}
+	}
+	g.printf("default:\nr.Skip()\n}\n}\n}\n")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateUpToDate(t *testing.T) {
+	for _, g := range []struct{ dir, typ, file string }{
+		{"../../pack", "CapturePacket", "capture_packet_codec.go"},
+		{"internal/sample", "Sample", "sample_codec.go"},
+	} {
+		src, err := Generate(g.dir, []string{g.typ})
+		if err != nil {
+			t.Fatal(err)
+		}
+		old, err := os.ReadFile(filepath.Join(g.dir, g.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(old), string(src), "generated code is out of date, run go generate in "+g.dir)
+	}
+}
@@ -0,0 +1,266 @@
+// Connbench runs the connection benchmarks outside of go test, over a matrix
+// of transports, modes, message sizes and concurrency levels, and prints a
+// table of the results.
+//
+//	connbench -transports tcp,tls,smux+tls -modes echo -sizes 64,1K,128K -concurrency 1,16
+//
+// A scenario file holds a JSON array of matrices with the same fields as the
+// flags, every matrix is run in order. Fields a matrix leaves out take the
+// values of the flags:
+//
+//	[{"transports": ["tcp", "http"], "modes": ["echo"], "sizes": [1024, "1M"], "concurrency": [1, 8], "duration": "2s"}]
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"benchmark/connection"
+)
+
+// Matrix expands to every combination of its fields.
+type Matrix struct {
+	Transports  []string   `json:"transports"`
+	Modes       []string   `json:"modes"`
+	Sizes       []byteSize `json:"sizes"`
+	Concurrency []int      `json:"concurrency"`
+	Rates       []float64  `json:"rates"` // open-loop ops per second, none for closed-loop
+	Duration    string     `json:"duration"`
+	Verify      bool       `json:"verify"`
+}
+
+// withDefaults fills the fields m leaves out with the ones of def. Rates are
+// left empty, which is closed-loop.
+func (m Matrix) withDefaults(def Matrix) Matrix {
+	if len(m.Transports) == 0 {
+		m.Transports = def.Transports
+	}
+	if len(m.Modes) == 0 {
+		m.Modes = def.Modes
+	}
+	if len(m.Sizes) == 0 {
+		m.Sizes = def.Sizes
+	}
+	if len(m.Concurrency) == 0 {
+		m.Concurrency = def.Concurrency
+	}
+	if m.Duration == "" {
+		m.Duration = def.Duration
+	}
+	return m
+}
+
+func (m Matrix) Scenarios() ([]connection.Scenario, error) {
+	d, err := time.ParseDuration(m.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := m.Rates
+	if len(rates) == 0 {
+		rates = []float64{0}
+	}
+
+	var ss []connection.Scenario
+	for _, t := range m.Transports {
+		for _, mode := range m.Modes {
+			if mode == connection.ModeThroughput && isHTTP(t) {
+				continue
+			}
+			for _, size := range m.Sizes {
+				for _, c := range m.Concurrency {
+					for _, rate := range rates {
+						if rate > 0 && mode != connection.ModeEcho {
+							continue
+						}
+						ss = append(ss, connection.Scenario{
+							Transport:   t,
+							Mode:        mode,
+							Size:        int(size),
+							Concurrency: c,
+							Duration:    d,
+							Verify:      m.Verify,
+							Rate:        rate,
+						})
+					}
+				}
+			}
+		}
+	}
+	return ss, nil
+}
+
+func isHTTP(t string) bool {
+	for _, h := range connection.HTTPTargets {
+		if t == h {
+			return true
+		}
+	}
+	return false
+}
+
+// byteSize is a number of bytes, with an optional K or M suffix in strings.
+type byteSize int
+
+func parseByteSize(s string) (byteSize, error) {
+	mul := 1
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mul, s = 1024, s[:len(s)-1]
+	case strings.HasSuffix(s, "M"):
+		mul, s = 1024*1024, s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid size " + s)
+	}
+	return byteSize(n * mul), nil
+}
+
+func (b *byteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) != nil {
+		s = string(data)
+	}
+	v, err := parseByteSize(s)
+	*b = v
+	return err
+}
+
+func (b byteSize) String() string {
+	switch {
+	case b >= 1024*1024 && b%(1024*1024) == 0:
+		return strconv.Itoa(int(b)/(1024*1024)) + "M"
+	case b >= 1024 && b%1024 == 0:
+		return strconv.Itoa(int(b)/1024) + "K"
+	}
+	return strconv.Itoa(int(b))
+}
+
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("connbench: ")
+
+	defaultTransports := strings.Join(append(append([]string{}, connection.TransportNames...), connection.HTTPTargets...), ",")
+	transports := flag.String("transports", defaultTransports, "comma-separated transports")
+	modes := flag.String("modes", connection.ModeThroughput+","+connection.ModeEcho, "comma-separated modes")
+	sizes := flag.String("sizes", "128K", "comma-separated message sizes, K and M suffixes allowed")
+	concurrency := flag.String("concurrency", "1", "comma-separated numbers of parallel connections or streams")
+	rates := flag.String("rates", "", "comma-separated open-loop echo rates in ops per second, closed-loop if empty")
+	duration := flag.Duration("duration", 2*time.Second, "duration of each scenario")
+	verify := flag.Bool("verify", false, "send random payloads and check the echoed ones")
+	file := flag.String("scenarios", "", "JSON scenario file, overrides the matrix flags")
+	flag.Parse()
+
+	flags := Matrix{Transports: splitList(*transports), Modes: splitList(*modes), Duration: duration.String(), Verify: *verify}
+	for _, s := range splitList(*sizes) {
+		size, err := parseByteSize(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		flags.Sizes = append(flags.Sizes, size)
+	}
+	for _, s := range splitList(*concurrency) {
+		c, err := strconv.Atoi(s)
+		if err != nil || c <= 0 {
+			log.Fatal("invalid concurrency ", s)
+		}
+		flags.Concurrency = append(flags.Concurrency, c)
+	}
+	for _, s := range splitList(*rates) {
+		r, err := strconv.ParseFloat(s, 64)
+		if err != nil || r <= 0 {
+			log.Fatal("invalid rate ", s)
+		}
+		flags.Rates = append(flags.Rates, r)
+	}
+
+	matrices := []Matrix{flags}
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		matrices = nil
+		err = json.Unmarshal(data, &matrices)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i := range matrices {
+			matrices[i] = matrices[i].withDefaults(flags)
+		}
+	}
+
+	var scenarios []connection.Scenario
+	for i, m := range matrices {
+		ss, err := m.Scenarios()
+		if err != nil {
+			log.Fatalf("matrix %d: %v", i, err)
+		}
+		scenarios = append(scenarios, ss...)
+	}
+	if len(scenarios) == 0 {
+		log.Fatal("no scenarios to run")
+	}
+
+	err := run(os.Stdout, scenarios)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run prints the table when every scenario is done, progress goes to
+// stderr. Latencies are of round trips in echo mode and of writes in
+// throughput mode, fairness is Jain's index of the ops per connection. In
+// open-loop runs ops/s is marked with a * when it falls short of the rate,
+// the first such rate is the saturation knee.
+func run(w io.Writer, scenarios []connection.Scenario) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "TRANSPORT\tMODE\tSIZE\tCONC\tRATE\tMB/s\tops/s\tfairness\tallocs/op\tshort/op\t")
+	for _, q := range connection.LatencyQuantiles {
+		fmt.Fprint(tw, connection.QuantileName(q), "\t")
+	}
+	fmt.Fprint(tw, "max\t\n")
+
+	for i, s := range scenarios {
+		log.Printf("[%d/%d] %s %s %v x%d rate %v", i+1, len(scenarios), s.Transport, s.Mode, byteSize(s.Size), s.Concurrency, s.Rate)
+		r, err := connection.Run(s)
+		if err != nil {
+			return fmt.Errorf("%s %s %v: %w", s.Transport, s.Mode, byteSize(s.Size), err)
+		}
+		rate, sat := "-", ""
+		if s.Rate > 0 {
+			rate = strconv.FormatFloat(s.Rate, 'f', -1, 64)
+		}
+		if r.Saturated() {
+			sat = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%d\t%s\t%.2f\t%.0f%s\t%.3f\t%.1f\t%.2f\t",
+			s.Transport, s.Mode, byteSize(s.Size), s.Concurrency, rate, r.MBPerSec(), r.OpsPerSec(), sat,
+			r.Fairness(), r.AllocsPerOp(), r.ShortReadsPerOp())
+		for _, q := range connection.LatencyQuantiles {
+			fmt.Fprint(tw, r.Latency.Quantile(q), "\t")
+		}
+		fmt.Fprintf(tw, "%v\t\n", r.Latency.Max())
+	}
+	return tw.Flush()
+}
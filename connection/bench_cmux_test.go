@@ -10,29 +10,6 @@ import (
 	"github.com/soheilhy/cmux"
 )
 
-const (
-	PacketMagic = 0x00114514
-	PacketToken = "xyz_token"
-)
-
-func PacketMagicMatcher(r io.Reader) bool {
-	buf := make([]byte, 4)
-	n, err := io.ReadFull(r, buf)
-	if err != nil {
-		return false
-	}
-	return binary.BigEndian.Uint32(buf[:n]) == 0x00114514
-}
-
-func PacketTokenMatcher(r io.Reader) bool {
-	buf := make([]byte, len(PacketToken))
-	n, err := io.ReadFull(r, buf)
-	if err != nil {
-		return false
-	}
-	return string(buf[:n]) == PacketToken
-}
-
 func wrapConnWithHeader(conn net.Conn, err error, header []byte) (net.Conn, error) {
 	if err != nil {
 		return nil, err
@@ -42,11 +19,10 @@ func wrapConnWithHeader(conn net.Conn, err error, header []byte) (net.Conn, erro
 }
 
 func wrapTLSListener(lis net.Listener) (net.Listener, error) {
-	crt, err := tls.X509KeyPair([]byte(testCrtData), []byte(testKeyData))
+	config, _, err := DefaultTLSConfig()
 	if err != nil {
 		return nil, err
 	}
-	config := &tls.Config{Certificates: []tls.Certificate{crt}}
 	return tls.NewListener(lis, config), nil
 }
 
@@ -82,7 +58,7 @@ func BenchmarkConnCmux(b *testing.B) {
 		defer conn1.Close()
 
 		io.CopyN(io.Discard, conn0, int64(len(buf)))
-		bench(b, conn0, conn1)
+		benchSizes(b, func(b *testing.B, size int) { bench(b, conn0, conn1, size) })
 	})
 
 	b.Run("TokenMatcher", func(b *testing.B) {
@@ -100,14 +76,14 @@ func BenchmarkConnCmux(b *testing.B) {
 		defer conn1.Close()
 
 		io.CopyN(io.Discard, conn0, int64(len(PacketToken)))
-		bench(b, conn0, conn1)
+		benchSizes(b, func(b *testing.B, size int) { bench(b, conn0, conn1, size) })
 	})
 
 	b.Run("TLSMatcher", func(b *testing.B) {
 		b.Run("TLS", func(b *testing.B) {
 			conn0, conn1, err := getConnPair(
 				func() (net.Listener, error) { return wrapTLSListener(tlsLis) },
-				func(s string) (net.Conn, error) { return tls.Dial("tcp", s, &tls.Config{InsecureSkipVerify: true}) },
+				dialTLS,
 			)
 			if err != nil {
 				b.Fatal(err)
@@ -115,7 +91,7 @@ func BenchmarkConnCmux(b *testing.B) {
 			defer conn0.Close()
 			defer conn1.Close()
 
-			bench(b, conn0, conn1)
+			benchSizes(b, func(b *testing.B, size int) { bench(b, conn0, conn1, size) })
 		})
 
 		tlsMuxLis, err := wrapTLSListener(tlsLis)
@@ -134,7 +110,7 @@ func BenchmarkConnCmux(b *testing.B) {
 			conn0, conn1, err := getConnPair(
 				func() (net.Listener, error) { return tlsMagicLis, nil },
 				func(s string) (net.Conn, error) {
-					conn, err := tls.Dial("tcp", s, &tls.Config{InsecureSkipVerify: true})
+					conn, err := dialTLS(s)
 					return wrapConnWithHeader(conn, err, buf)
 				},
 			)
@@ -145,7 +121,7 @@ func BenchmarkConnCmux(b *testing.B) {
 			defer conn1.Close()
 
 			io.CopyN(io.Discard, conn0, int64(len(buf)))
-			bench(b, conn0, conn1)
+			benchSizes(b, func(b *testing.B, size int) { bench(b, conn0, conn1, size) })
 		})
 
 	})
@@ -166,8 +142,20 @@ func BenchmarkConnCmux(b *testing.B) {
 		defer conn1.Close()
 
 		io.CopyN(io.Discard, conn0, int64(len(buf)))
-		bench(b, conn0, conn1)
+		benchSizes(b, func(b *testing.B, size int) { bench(b, conn0, conn1, size) })
 	})
+
+	for _, t := range []Transport{NewUnixTransport(), NewUnixPacketTransport()} {
+		b.Run(unixBenchName(t), func(b *testing.B) {
+			conn0, conn1, err := ConnPair(NewCmuxTransport(t, PacketMagicMatcher, PacketMagicHeader()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn0.Close()
+			defer conn1.Close()
+			benchSizes(b, func(b *testing.B, size int) { bench(b, conn0, conn1, size) })
+		})
+	}
 }
 
 func BenchmarkEchoCmux(b *testing.B) {
@@ -181,6 +169,22 @@ func BenchmarkEchoCmux(b *testing.B) {
 	l := m.Match(cmux.Any())
 	go m.Serve()
 
-	go serveEcho(b, l)
-	benchEcho(b, func(s string) (net.Conn, error) { return net.Dial("tcp", s) }, lis.Addr().String())
+	go serveEcho(l)
+	benchSizes(b, func(b *testing.B, size int) {
+		benchEcho(b, func(s string) (net.Conn, error) { return net.Dial("tcp", s) }, lis.Addr().String(), size)
+	})
+
+	for _, t := range []Transport{NewUnixTransport(), NewUnixPacketTransport()} {
+		b.Run(unixBenchName(t), func(b *testing.B) {
+			t := NewCmuxTransport(t, PacketMagicMatcher, PacketMagicHeader())
+			lis, err := t.Listen("")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer lis.Close()
+
+			go serveEcho(lis)
+			benchSizes(b, func(b *testing.B, size int) { benchEcho(b, t.Dial, lis.Addr().String(), size) })
+		})
+	}
 }
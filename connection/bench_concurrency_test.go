@@ -0,0 +1,114 @@
+package connection
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// ConcurrencyLevels are the numbers of parallel connections, or streams on
+// one session for mux transports.
+var ConcurrencyLevels = []int{1, 8, 64}
+
+func BenchmarkConcurrent(b *testing.B) {
+	for _, name := range TransportNames {
+		b.Run(name, func(b *testing.B) {
+			for _, n := range ConcurrencyLevels {
+				b.Run("n="+strconv.Itoa(n), func(b *testing.B) {
+					t, err := TransportByName(name)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if c, ok := t.(io.Closer); ok {
+						defer c.Close()
+					}
+					benchConcurrent(b, t, n, 16<<10)
+				})
+			}
+		})
+	}
+}
+
+// benchConcurrent writes b.N messages of size over n connections of t at
+// once, the connections take messages from a shared counter so faster ones
+// do more. It reports the aggregate throughput and Jain's fairness index of
+// the bytes received per connection.
+func benchConcurrent(b *testing.B, t Transport, n, size int) {
+	lis, err := t.Listen("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer lis.Close()
+
+	received := make([]int64, n)
+	var rwg sync.WaitGroup
+	rwg.Add(n)
+	acceptErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			conn, err := lis.Accept()
+			if err != nil {
+				// Release the readers that will never start.
+				rwg.Add(i - n)
+				acceptErr <- err
+				return
+			}
+			go func(conn net.Conn, count *int64) {
+				defer rwg.Done()
+				defer conn.Close()
+				*count, _ = io.Copy(io.Discard, conn)
+			}(conn, &received[i])
+		}
+	}()
+
+	conns := make([]net.Conn, n)
+	for i := range conns {
+		conns[i], err = t.Dial(lis.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var (
+		next int64
+		wwg  sync.WaitGroup
+	)
+	for _, conn := range conns {
+		wwg.Add(1)
+		go func(conn net.Conn) {
+			defer wwg.Done()
+			defer conn.Close()
+			for atomic.AddInt64(&next, 1) <= int64(b.N) {
+				_, err := conn.Write(buf)
+				if err != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+	wwg.Wait()
+	rwg.Wait()
+	b.StopTimer()
+	select {
+	case err := <-acceptErr:
+		b.Fatal(err)
+	default:
+	}
+
+	var total int64
+	for _, c := range received {
+		total += c
+	}
+	if total != int64(size)*int64(b.N) {
+		b.Fatalf("received %d bytes, want %d", total, int64(size)*int64(b.N))
+	}
+	b.ReportMetric(jainIndex(received), "fairness")
+}
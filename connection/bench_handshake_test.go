@@ -0,0 +1,127 @@
+package connection
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// BenchmarkHandshake measures connection setup alone: an op is done when the
+// client has dialed and the server has accepted and handshaked, no data is
+// sent. It reports the setup latency and connections per second, the latter
+// including the close.
+func BenchmarkHandshake(b *testing.B) {
+	tlsTransport := func(version uint16, resume bool) func() (Transport, error) {
+		return func() (Transport, error) {
+			server, client, err := DefaultTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			client.MinVersion, client.MaxVersion = version, version
+			if resume {
+				client.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+			} else {
+				server.SessionTicketsDisabled = true
+			}
+			return NewTLSTransport(NewTCPTransport(), server, client)
+		}
+	}
+
+	for _, c := range []struct {
+		name      string
+		transport func() (Transport, error)
+		resume    bool
+	}{
+		{"tcp", func() (Transport, error) { return NewTCPTransport(), nil }, false},
+		{"tls1.2", tlsTransport(tls.VersionTLS12, false), false},
+		{"tls1.3", tlsTransport(tls.VersionTLS13, false), false},
+		{"tls1.2-resume", tlsTransport(tls.VersionTLS12, true), true},
+		{"tls1.3-resume", tlsTransport(tls.VersionTLS13, true), true},
+		{"smux-stream", func() (Transport, error) { return NewSmuxTransport(NewTCPTransport(), nil), nil }, false},
+		{"yamux-stream", func() (Transport, error) { return NewYamuxTransport(NewTCPTransport(), nil), nil }, false},
+		{"quic-stream", func() (Transport, error) { return NewQUICTransport(nil, nil, nil) }, false},
+		{"cmux", func() (Transport, error) {
+			return NewCmuxTransport(NewTCPTransport(), PacketMagicMatcher, PacketMagicHeader()), nil
+		}, false},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			t, err := c.transport()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if cl, ok := t.(io.Closer); ok {
+				defer cl.Close()
+			}
+			benchHandshake(b, t, c.resume)
+		})
+	}
+}
+
+// benchHandshake dials t b.N times one after another. With resume every TLS
+// handshake after the first one must resume the session.
+func benchHandshake(b *testing.B, t Transport, resume bool) {
+	lis, err := t.Listen("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer lis.Close()
+
+	type accepted struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan accepted, 1)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err == nil {
+				if tc, ok := conn.(*tls.Conn); ok {
+					err = tc.Handshake()
+				}
+			}
+			ch <- accepted{conn, err}
+			if conn == nil {
+				return
+			}
+		}
+	}()
+
+	var h Histogram
+	connect := func(check bool) {
+		start := time.Now()
+		conn, err := t.Dial(lis.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		a := <-ch
+		if a.err != nil {
+			b.Fatal(a.err)
+		}
+		h.Record(time.Since(start))
+
+		// Reading to the server's close also gets the TLS 1.3 session
+		// tickets, which come after the handshake.
+		a.conn.Close()
+		io.Copy(io.Discard, conn)
+		if tc, ok := conn.(*tls.Conn); ok && check && resume && !tc.ConnectionState().DidResume {
+			b.Fatal("session not resumed")
+		}
+		conn.Close()
+	}
+
+	// The first op sets up the mux session or the TLS session ticket.
+	connect(false)
+	h = Histogram{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		connect(true)
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	reportLatency(b, &h)
+	b.ReportMetric(float64(b.N)/elapsed.Seconds(), "conns/s")
+}
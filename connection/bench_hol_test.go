@@ -0,0 +1,142 @@
+package connection
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchmarkHOL measures head-of-line blocking: small round trips run next to
+// a bulk transfer, on streams of one smux session or on separate TCP
+// connections, with and without a lossy link. The latency of the small round
+// trips is reported, to compare with the idle runs, and bulk-MB/s is what the
+// bulk transfer got meanwhile.
+func BenchmarkHOL(b *testing.B) {
+	for _, lossy := range []bool{false, true} {
+		for _, mux := range []bool{true, false} {
+			for _, bulk := range []bool{false, true} {
+				name := "tcp"
+				t := Transport(NewTCPTransport())
+				if lossy {
+					name += "-lossy"
+					t = NewImpairedTransport(t, Impairment{Loss: 0.01, Stall: 5 * time.Millisecond})
+				}
+				if mux {
+					name = "smux+" + name
+					t = NewSmuxTransport(t, nil)
+				}
+				if bulk {
+					name += "/bulk"
+				} else {
+					name += "/idle"
+				}
+				b.Run(name, func(b *testing.B) {
+					if c, ok := t.(io.Closer); ok {
+						defer c.Close()
+					}
+					benchHOL(b, t, bulk)
+				})
+			}
+		}
+	}
+}
+
+func benchHOL(b *testing.B, t Transport, bulk bool) {
+	lis, err := t.Listen("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer lis.Close()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			// The first byte tells a bulk connection from an echo one.
+			go func(conn net.Conn) {
+				defer conn.Close()
+				kind := make([]byte, 1)
+				if _, err := io.ReadFull(conn, kind); err != nil {
+					return
+				}
+				if kind[0] == 'b' {
+					io.Copy(io.Discard, conn)
+				} else {
+					io.Copy(conn, conn)
+				}
+			}(conn)
+		}
+	}()
+
+	var (
+		sent int64
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	if bulk {
+		conn, err := t.Dial(lis.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte{'b'})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, BufSize)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n, err := conn.Write(buf)
+				atomic.AddInt64(&sent, int64(n))
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	conn, err := t.Dial(lis.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{'e'})
+
+	req := makePayload(64)
+	resp := make([]byte, len(req))
+	var h Histogram
+	b.ResetTimer()
+	start := time.Now()
+	sent0 := atomic.LoadInt64(&sent)
+	for i := 0; i < b.N; i++ {
+		begin := time.Now()
+		_, err := writeRead(conn, req, resp)
+		if err != nil {
+			b.Fatal(err)
+		}
+		h.Record(time.Since(begin))
+	}
+	elapsed := time.Since(start)
+	b.StopTimer()
+	bulkBytes := atomic.LoadInt64(&sent) - sent0
+	close(stop)
+	lis.Close()
+	if c, ok := t.(io.Closer); ok {
+		c.Close()
+	}
+	wg.Wait()
+
+	reportLatency(b, &h)
+	if bulk {
+		b.ReportMetric(float64(bulkBytes)/1e6/elapsed.Seconds(), "bulk-MB/s")
+	}
+}
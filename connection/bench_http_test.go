@@ -1,58 +1,221 @@
 package connection
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// BenchmarkEchoFastHTTP posts to a fasthttp echo server with fasthttp.Client,
+// see benchHTTPClients.
 func BenchmarkEchoFastHTTP(b *testing.B) {
-	lis, err := net.Listen("tcp", "localhost:0")
+	lis, err := listenCounting()
 	if err != nil {
 		b.Fatal(err)
 	}
 	defer lis.Close()
 
-	buf := make([]byte, BufSize)
-	go fasthttp.Serve(lis, func(ctx *fasthttp.RequestCtx) { ctx.Response.SetBody(buf) })
-	benchHTTPEcho(b, func(s string) (net.Conn, error) { return net.Dial("tcp", s) }, lis.Addr().String())
+	go fasthttp.Serve(lis, func(ctx *fasthttp.RequestCtx) { ctx.SetBody(ctx.PostBody()) })
+	url := "http://" + lis.Addr().String() + "/"
+	benchHTTPClients(b, lis,
+		&fastHTTPClient{url: url, c: &fasthttp.Client{MaxConnsPerHost: 1}},
+		&fastHTTPClient{url: url, c: closingFastHTTPClient{&fasthttp.Client{}}})
 }
 
+// BenchmarkEchoNetHTTP posts to a net/http echo server with the net/http
+// client, see benchHTTPClients.
 func BenchmarkEchoNetHTTP(b *testing.B) {
-	lis, err := net.Listen("tcp", "localhost:0")
+	lis, err := listenCounting()
 	if err != nil {
 		b.Fatal(err)
 	}
 	defer lis.Close()
 
-	buf := make([]byte, BufSize)
+	go http.Serve(lis, http.HandlerFunc(echoHTTP))
+	url := "http://" + lis.Addr().String() + "/"
+	benchHTTPClients(b, lis,
+		&netHTTPClient{url: url, c: &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 1}}},
+		&netHTTPClient{url: url, c: &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}})
+}
+
+// benchHTTPClients runs the HTTP/1.1 echo benchmarks on the server behind
+// lis: KeepAlive reuses one connection, NewConn opens one per request and
+// Pipeline sends 16 requests at once on one connection, with
+// fasthttp.PipelineClient as net/http does not pipeline.
+func benchHTTPClients(b *testing.B, lis *countingListener, keepAlive, newConn echoClient) {
+	defer keepAlive.Close()
+	defer newConn.Close()
+	pipeline := &fastHTTPClient{
+		url: "http://" + lis.Addr().String() + "/",
+		c:   &fasthttp.PipelineClient{Addr: lis.Addr().String(), MaxConns: 1},
+	}
 
-	h := http.NewServeMux()
-	h.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write(buf) })
-	go http.Serve(lis, h)
-	benchHTTPEcho(b, func(s string) (net.Conn, error) { return net.Dial("tcp", s) }, lis.Addr().String())
+	b.Run("KeepAlive", func(b *testing.B) {
+		benchSizes(b, func(b *testing.B, size int) { benchHTTPEcho(b, keepAlive, lis, size, false) })
+	})
+	b.Run("NewConn", func(b *testing.B) {
+		benchSizes(b, func(b *testing.B, size int) { benchHTTPEcho(b, newConn, lis, size, false) })
+	})
+	b.Run("Pipeline", func(b *testing.B) {
+		benchSizes(b, func(b *testing.B, size int) { benchHTTPEcho(b, pipeline, lis, size, true) })
+	})
 }
 
-func benchHTTPEcho(b *testing.B, dialer func(string) (net.Conn, error), addr string) {
-	buf := make([]byte, BufSize)
-	buf2 := make([]byte, BufSize)
-	b.SetBytes(BufSize)
-	b.ResetTimer()
-	b.ReportAllocs()
+// closingFastHTTPClient asks for the connection to be closed after every
+// request.
+type closingFastHTTPClient struct{ *fasthttp.Client }
+
+func (c closingFastHTTPClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	req.SetConnectionClose()
+	return c.Client.Do(req, resp)
+}
+
+// BenchmarkEchoHTTP2 posts over HTTP/2 with TLS and over h2c, its cleartext
+// form, one request at a time and from 16 goroutines at once. Both run on one
+// connection.
+func BenchmarkEchoHTTP2(b *testing.B) {
+	for _, name := range []string{"TLS", "H2C"} {
+		b.Run(name, func(b *testing.B) {
+			e, err := startHTTP2Echo(name == "TLS")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer e.Close()
+
+			for _, parallel := range []bool{false, true} {
+				mode := "Serial"
+				if parallel {
+					mode = "Parallel"
+				}
+				b.Run(mode, func(b *testing.B) {
+					benchSizes(b, func(b *testing.B, size int) { benchHTTPEcho(b, e, e.lis, size, parallel) })
+				})
+			}
+		})
+	}
+}
+
+// http2Echo is an HTTP/2 echo server and a client for it.
+type http2Echo struct {
+	netHTTPClient
+	lis *countingListener
+	srv *http.Server
+}
+
+func (e *http2Echo) Close() error {
+	e.netHTTPClient.Close()
+	return e.srv.Close()
+}
 
-	rawRequest := `GET / HTTP/1.1
-Host: 192.168.119.200:443
+// startHTTP2Echo starts an http2Echo with TLS or h2c.
+func startHTTP2Echo(withTLS bool) (*http2Echo, error) {
+	lis, err := listenCounting()
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(echoHTTP)}
+	t := &http2.Transport{}
+	url := "https://" + lis.Addr().String() + "/"
+	if withTLS {
+		server, client, err := DefaultTLSConfig()
+		if err != nil {
+			lis.Close()
+			return nil, err
+		}
+		srv.TLSConfig = server.Clone()
+		err = http2.ConfigureServer(srv, &http2.Server{})
+		if err != nil {
+			lis.Close()
+			return nil, err
+		}
+		go srv.ServeTLS(lis, "", "")
+		t.TLSClientConfig = client
+	} else {
+		srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{})
+		go srv.Serve(lis)
+		// h2c is HTTP/2 from the first byte on a plain connection.
+		t.AllowHTTP = true
+		t.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+		url = "http://" + lis.Addr().String() + "/"
+	}
+	return &http2Echo{
+		netHTTPClient: netHTTPClient{url: url, c: &http.Client{Transport: t}},
+		lis:           lis,
+		srv:           srv,
+	}, nil
+}
 
-hello`
+// countingListener counts the accepted connections.
+type countingListener struct {
+	net.Listener
+	accepted int64
+}
 
-	copy(buf, []byte(rawRequest))
+func listenCounting() (*countingListener, error) {
+	lis, err := NewTCPTransport().Listen("")
+	if err != nil {
+		return nil, err
+	}
+	return &countingListener{Listener: lis}, nil
+}
 
-	for i := 0; i < b.N; i++ {
-		conn, _ := dialer(addr)
-		conn.Write(buf)
-		conn.Read(buf2)
-		conn.Close()
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt64(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+// benchHTTPEcho posts size bytes with c, which checks the status and the
+// body length, and checks the body is the same. It runs from exactly 16
+// goroutines at once when parallel, below the 250 streams an HTTP/2 server
+// allows by default, else one request at a time with the latency reported.
+// conns/op is the connections lis accepted per request, 0 when they are
+// reused.
+func benchHTTPEcho(b *testing.B, c echoClient, lis *countingListener, size int, parallel bool) {
+	req := makePayload(size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	accepted := atomic.LoadInt64(&lis.accepted)
+	b.ResetTimer()
+
+	echo := func(resp []byte) error {
+		_, err := c.Echo(req, resp)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(req, resp) {
+			return ErrEchoMismatch
+		}
+		return nil
+	}
+	if parallel {
+		runConcurrent(b, 16, size, echo)
+	} else {
+		resp := make([]byte, size)
+		var h Histogram
+		for i := 0; i < b.N; i++ {
+			start := time.Now()
+			if err := echo(resp); err != nil {
+				b.Fatal(err)
+			}
+			h.Record(time.Since(start))
+		}
+		b.StopTimer()
+		reportLatency(b, &h)
 	}
+	b.ReportMetric(float64(atomic.LoadInt64(&lis.accepted)-accepted)/float64(b.N), "conns/op")
 }
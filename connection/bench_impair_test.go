@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// impairProfiles are the links of BenchmarkImpaired.
+var impairProfiles = []struct {
+	name string
+	imp  Impairment
+}{
+	{"lan", Impairment{Latency: 250 * time.Microsecond}},
+	{"wan", Impairment{Latency: 20 * time.Millisecond, Jitter: 2 * time.Millisecond, Bandwidth: 100e6 / 8}},
+	{"lossy-wan", Impairment{Latency: 20 * time.Millisecond, Jitter: 2 * time.Millisecond, Bandwidth: 100e6 / 8, Loss: 0.01, Stall: 40 * time.Millisecond}},
+}
+
+// impairStacks put the impairment under TLS and smux, as the network is.
+var impairStacks = []struct {
+	name      string
+	transport func(imp Impairment) (Transport, error)
+}{
+	{"tcp", func(imp Impairment) (Transport, error) {
+		return NewImpairedTransport(NewTCPTransport(), imp), nil
+	}},
+	{"tls", func(imp Impairment) (Transport, error) {
+		return NewTLSTransport(NewImpairedTransport(NewTCPTransport(), imp), nil, nil)
+	}},
+	{"smux+tls", func(imp Impairment) (Transport, error) {
+		t, err := NewTLSTransport(NewImpairedTransport(NewTCPTransport(), imp), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return NewSmuxTransport(t, nil), nil
+	}},
+}
+
+// impairSizes are the message sizes of BenchmarkImpaired, on a slow link the
+// larger ones take long.
+var impairSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+// BenchmarkImpaired runs one way throughput and round trips on one
+// connection of every impairStacks entry over every impairProfiles link.
+func BenchmarkImpaired(b *testing.B) {
+	for _, p := range impairProfiles {
+		b.Run(p.name, func(b *testing.B) {
+			for _, s := range impairStacks {
+				b.Run(s.name, func(b *testing.B) {
+					b.Run("Throughput", func(b *testing.B) {
+						cs, ss := impairedConnPair(b, s.transport, p.imp)
+						for _, size := range impairSizes {
+							b.Run(SizeName(size), func(b *testing.B) { bench(b, cs, ss, size) })
+						}
+					})
+
+					b.Run("Echo", func(b *testing.B) {
+						cs, ss := impairedConnPair(b, s.transport, p.imp)
+						go io.Copy(ss, ss)
+						for _, size := range impairSizes {
+							b.Run(SizeName(size), func(b *testing.B) { benchStreamEcho(b, cs, size) })
+						}
+					})
+				})
+			}
+		})
+	}
+}
+
+func impairedConnPair(b *testing.B, transport func(Impairment) (Transport, error), imp Impairment) (net.Conn, net.Conn) {
+	t, err := transport(imp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cs, ss, err := ConnPair(t)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		cs.Close()
+		ss.Close()
+		if c, ok := t.(io.Closer); ok {
+			c.Close()
+		}
+	})
+	return cs, ss
+}
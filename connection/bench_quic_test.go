@@ -0,0 +1,74 @@
+package connection
+
+import (
+	"io"
+	"testing"
+)
+
+func BenchmarkConnQUIC(b *testing.B) {
+	t, err := NewQUICTransport(nil, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer t.(io.Closer).Close()
+
+	cs, ss, err := ConnPair(t)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cs.Close()
+	defer ss.Close()
+	benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+}
+
+// BenchmarkEchoQUIC opens a stream per round trip on one connection, as
+// BenchmarkEchoSmux does.
+func BenchmarkEchoQUIC(b *testing.B) {
+	t, err := NewQUICTransport(nil, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer t.(io.Closer).Close()
+
+	lis, err := t.Listen("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer lis.Close()
+
+	go serveEcho(lis)
+	benchSizes(b, func(b *testing.B, size int) { benchEcho(b, t.Dial, lis.Addr().String(), size) })
+}
+
+// BenchmarkEchoStreams compares QUIC with smux and yamux over TLS, the
+// closest stream transports, running round trips on 16 streams of one
+// connection at once.
+func BenchmarkEchoStreams(b *testing.B) {
+	for _, name := range []string{"quic", "smux+tls", "yamux+tls"} {
+		b.Run(name, func(b *testing.B) {
+			t, err := TransportByName(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer t.(io.Closer).Close()
+
+			lis, err := t.Listen("")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer lis.Close()
+
+			go serveEcho(lis)
+			benchSizes(b, func(b *testing.B, size int) {
+				req := makePayload(size)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				runConcurrent(b, 16, size, func(resp []byte) error {
+					_, err := echoOnce(t.Dial, lis.Addr().String(), req, resp)
+					return err
+				})
+			})
+		})
+	}
+}
@@ -1,38 +1,50 @@
 package connection
 
 import (
+	"io"
 	"net"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/xtaci/smux"
 )
 
-type SmuxSession struct{ *smux.Session }
-
-func (s *SmuxSession) Addr() net.Addr            { return s.Session.LocalAddr() }
-func (s *SmuxSession) Accept() (net.Conn, error) { return s.Session.AcceptStream() }
-func (s *SmuxSession) Close() error              { return s.Session.Close() }
-
 func BenchmarkConnSmux(b *testing.B) {
 	b.Run("OverTCP", func(b *testing.B) {
-		cs, ss, err := getTCPSmuxStreamPair()
+		cs, ss, mux, err := getTCPSmuxStreamPair()
 		if err != nil {
 			b.Fatal(err)
 		}
+		defer mux.Close()
 		defer cs.Close()
 		defer ss.Close()
-		bench(b, cs, ss)
+		benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
 	})
 
 	b.Run("OverTLS", func(b *testing.B) {
-		cs, ss, err := getTLSSmuxStreamPair()
+		cs, ss, mux, err := getTLSSmuxStreamPair()
 		if err != nil {
 			b.Fatal(err)
 		}
+		defer mux.Close()
 		defer cs.Close()
 		defer ss.Close()
-		bench(b, cs, ss)
+		benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
 	})
+
+	for _, t := range []Transport{NewUnixTransport(), NewUnixPacketTransport()} {
+		b.Run(unixBenchName(t), func(b *testing.B) {
+			cs, ss, mux, err := muxConnPair(NewSmuxTransport(t, nil))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer mux.Close()
+			defer cs.Close()
+			defer ss.Close()
+			benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+		})
+	}
 }
 
 func BenchmarkEchoSmux(b *testing.B) {
@@ -51,6 +63,16 @@ func BenchmarkEchoSmux(b *testing.B) {
 		}
 		benchEchoSmux(b, conn0, conn1)
 	})
+
+	for _, t := range []Transport{NewUnixTransport(), NewUnixPacketTransport()} {
+		b.Run(unixBenchName(t), func(b *testing.B) {
+			conn0, conn1, err := ConnPair(t)
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchEchoSmux(b, conn0, conn1)
+		})
+	}
 }
 
 func benchEchoSmux(b *testing.B, conn0, conn1 net.Conn) {
@@ -60,52 +82,180 @@ func benchEchoSmux(b *testing.B, conn0, conn1 net.Conn) {
 	cs, _ := smux.Client(conn0, nil)
 	ss, _ := smux.Server(conn1, nil)
 
-	go serveEcho(b, &SmuxSession{Session: ss})
-	benchEcho(b, func(s string) (net.Conn, error) { return cs.OpenStream() }, "")
+	go serveEcho(&SmuxSession{Session: ss})
+	benchSizes(b, func(b *testing.B, size int) {
+		benchEcho(b, func(s string) (net.Conn, error) { return cs.OpenStream() }, "", size)
+	})
 }
 
-// Code from https://github.com/xtaci/smux/blob/master/session_test.go#L1005
-func getTCPSmuxStreamPair() (*smux.Stream, *smux.Stream, error) {
-	c1, c2, err := getTCPConnPair()
+func getTCPSmuxStreamPair() (net.Conn, net.Conn, io.Closer, error) {
+	return muxConnPair(NewSmuxTransport(NewTCPTransport(), nil))
+}
+
+func getTLSSmuxStreamPair() (net.Conn, net.Conn, io.Closer, error) {
+	t, err := NewTLSTransport(NewTCPTransport(), nil, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return getSmuxStreamPair(c1, c2)
+	return muxConnPair(NewSmuxTransport(t, nil))
 }
 
-func getTLSSmuxStreamPair() (*smux.Stream, *smux.Stream, error) {
-	c1, c2, err := getTLSConnPair()
+// muxConnPair is ConnPair over a mux transport, which is returned to be
+// closed once the streams are: its session outlives them.
+func muxConnPair(t Transport) (net.Conn, net.Conn, io.Closer, error) {
+	mux := t.(io.Closer)
+	cs, ss, err := ConnPair(t)
 	if err != nil {
-		return nil, nil, err
+		mux.Close()
+		return nil, nil, nil, err
 	}
-	return getSmuxStreamPair(c1, c2)
+	return cs, ss, mux, nil
 }
 
-func getSmuxStreamPair(c1, c2 net.Conn) (*smux.Stream, *smux.Stream, error) {
-	s, err := smux.Server(c2, nil)
-	if err != nil {
-		return nil, nil, err
+// smuxConfigs changes one setting of the default config at a time. Version 1
+// has no per stream flow control, MaxStreamBuffer only applies to version 2.
+func smuxConfigs() []struct {
+	name   string
+	config *smux.Config
+} {
+	with := func(fn func(c *smux.Config)) *smux.Config {
+		c := smux.DefaultConfig()
+		fn(c)
+		return c
 	}
-	c, err := smux.Client(c1, nil)
-	if err != nil {
-		return nil, nil, err
+	return []struct {
+		name   string
+		config *smux.Config
+	}{
+		{"default", smux.DefaultConfig()},
+		{"v2", with(func(c *smux.Config) { c.Version = 2 })},
+		{"frame=4KiB", with(func(c *smux.Config) { c.MaxFrameSize = 4 << 10 })},
+		{"frame=65535B", with(func(c *smux.Config) { c.MaxFrameSize = 65535 })},
+		{"recvbuf=1MiB", with(func(c *smux.Config) { c.MaxReceiveBuffer = 1 << 20 })},
+		{"recvbuf=16MiB", with(func(c *smux.Config) { c.MaxReceiveBuffer = 16 << 20 })},
+		{"v2-streambuf=16KiB", with(func(c *smux.Config) { c.Version, c.MaxStreamBuffer = 2, 16<<10 })},
+		{"v2-streambuf=1MiB", with(func(c *smux.Config) { c.Version, c.MaxStreamBuffer = 2, 1<<20 })},
+		{"keepalive=1s", with(func(c *smux.Config) { c.KeepAliveInterval, c.KeepAliveTimeout = time.Second, 3*time.Second })},
+		{"keepalive=off", with(func(c *smux.Config) { c.KeepAliveDisabled = true })},
 	}
-	var ss *smux.Stream
-	done := make(chan error)
-	go func() {
-		var rerr error
-		ss, rerr = s.AcceptStream()
-		done <- rerr
-		close(done)
-	}()
-	cs, err := c.OpenStream()
+}
+
+// smuxSweepSizes are the message sizes of BenchmarkSmuxConfig, fewer than
+// BenchSizes as there are many configs.
+var smuxSweepSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+// BenchmarkSmuxConfig runs every smuxConfigs entry over TCP: one way
+// throughput and round trip latency on one stream, and the memory of both
+// sides per open stream in Streams.
+func BenchmarkSmuxConfig(b *testing.B) {
+	for _, c := range smuxConfigs() {
+		b.Run(c.name, func(b *testing.B) {
+			b.Run("Throughput", func(b *testing.B) {
+				cs, ss, mux, err := muxConnPair(NewSmuxTransport(NewTCPTransport(), c.config))
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer mux.Close()
+				defer cs.Close()
+				defer ss.Close()
+				for _, size := range smuxSweepSizes {
+					b.Run(SizeName(size), func(b *testing.B) { bench(b, cs, ss, size) })
+				}
+			})
+
+			b.Run("Echo", func(b *testing.B) {
+				cs, ss, mux, err := muxConnPair(NewSmuxTransport(NewTCPTransport(), c.config))
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer mux.Close()
+				defer cs.Close()
+				defer ss.Close()
+				go io.Copy(ss, ss)
+				for _, size := range smuxSweepSizes {
+					b.Run(SizeName(size), func(b *testing.B) { benchStreamEcho(b, cs, size) })
+				}
+			})
+
+			b.Run("Streams", func(b *testing.B) {
+				t := NewSmuxTransport(NewTCPTransport(), c.config)
+				defer t.(io.Closer).Close()
+				benchStreamMemory(b, t)
+			})
+		})
+	}
+}
+
+// streamEchoInline is the largest request benchStreamEcho writes before
+// reading the response, the echo of larger ones may not fit in the stream
+// window of a mux.
+const streamEchoInline = 4 << 10
+
+// benchStreamEcho does b.N round trips on conn, which is echoed.
+func benchStreamEcho(b *testing.B, conn net.Conn, size int) {
+	req := makePayload(size)
+	resp := make([]byte, size)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var h Histogram
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		_, err := writeReadInline(conn, req, resp, streamEchoInline)
+		if err != nil {
+			b.Fatal(err)
+		}
+		h.Record(time.Since(start))
+	}
+	b.StopTimer()
+	reportLatency(b, &h)
+}
+
+// benchStreamMemory opens b.N streams of t, each doing a 1KiB round trip,
+// and keeps them open to report the heap and stack they take on both sides.
+func benchStreamMemory(b *testing.B, t Transport) {
+	lis, err := t.Listen("")
 	if err != nil {
-		return nil, nil, err
+		b.Fatal(err)
 	}
-	err = <-done
+	defer lis.Close()
+	go serveEcho(lis)
+
+	req := makePayload(1 << 10)
+	resp := make([]byte, len(req))
+	// The session is set up before measuring.
+	first, err := t.Dial(lis.Addr().String())
 	if err != nil {
-		return nil, nil, err
+		b.Fatal(err)
 	}
+	defer first.Close()
 
-	return cs, ss, nil
+	var ms0, ms1 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms0)
+	conns := make([]net.Conn, 0, b.N)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, err := t.Dial(lis.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		conns = append(conns, conn)
+		_, err = writeRead(conn, req, resp)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&ms1)
+	used := int64(ms1.HeapAlloc+ms1.StackInuse) - int64(ms0.HeapAlloc+ms0.StackInuse)
+	b.ReportMetric(float64(used)/float64(b.N), "B/stream")
 }
@@ -3,6 +3,7 @@ package connection
 import (
 	"crypto/tls"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -13,7 +14,7 @@ func BenchmarkConnTCP(b *testing.B) {
 	}
 	defer cs.Close()
 	defer ss.Close()
-	bench(b, cs, ss)
+	benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
 }
 
 func BenchmarkConnTLS(b *testing.B) {
@@ -23,7 +24,7 @@ func BenchmarkConnTLS(b *testing.B) {
 	}
 	defer cs.Close()
 	defer ss.Close()
-	bench(b, cs, ss)
+	benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
 }
 
 func BenchmarkEchoTCP(b *testing.B) {
@@ -33,22 +34,175 @@ func BenchmarkEchoTCP(b *testing.B) {
 	}
 	defer lis.Close()
 
-	go serveEcho(b, lis)
-	benchEcho(b, func(s string) (net.Conn, error) { return net.Dial("tcp", s) }, lis.Addr().String())
+	go serveEcho(lis)
+	benchSizes(b, func(b *testing.B, size int) {
+		benchEcho(b, func(s string) (net.Conn, error) { return net.Dial("tcp", s) }, lis.Addr().String(), size)
+	})
 }
 
 func BenchmarkEchoTLS(b *testing.B) {
-	crt, err := tls.X509KeyPair([]byte(testCrtData), []byte(testKeyData))
+	config, _, err := DefaultTLSConfig()
 	if err != nil {
 		b.Fatal(err)
 	}
 
-	lis, err := tls.Listen("tcp", "localhost:0", &tls.Config{Certificates: []tls.Certificate{crt}})
+	lis, err := tls.Listen("tcp", "localhost:0", config)
 	if err != nil {
 		b.Fatal(err)
 	}
 	defer lis.Close()
 
-	go serveEcho(b, lis)
-	benchEcho(b, func(s string) (net.Conn, error) { return tls.Dial("tcp", s, &tls.Config{InsecureSkipVerify: true}) }, lis.Addr().String())
+	go serveEcho(lis)
+	benchSizes(b, func(b *testing.B, size int) {
+		benchEcho(b, dialTLS, lis.Addr().String(), size)
+	})
+}
+
+// BenchmarkTLSKeyType measures handshakes over every key type of KeyTypes,
+// with TLS 1.3 and the TLS 1.2 ECDHE suites the key can sign for.
+func BenchmarkTLSKeyType(b *testing.B) {
+	for _, keyType := range KeyTypes {
+		suites := []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		}
+		if strings.HasPrefix(keyType, "rsa") {
+			suites = []uint16{
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			}
+		}
+		b.Run(keyType, func(b *testing.B) {
+			run := func(name string, version, suite uint16) {
+				b.Run(name, func(b *testing.B) {
+					server, client, err := TLSConfigs(keyType)
+					if err != nil {
+						b.Fatal(err)
+					}
+					server.SessionTicketsDisabled = true
+					client.MinVersion, client.MaxVersion = version, version
+					if suite != 0 {
+						client.CipherSuites = []uint16{suite}
+					}
+					t, err := NewTLSTransport(NewTCPTransport(), server, client)
+					if err != nil {
+						b.Fatal(err)
+					}
+					benchHandshake(b, t, false)
+				})
+			}
+			run("TLS13", tls.VersionTLS13, 0)
+			for _, suite := range suites {
+				run(tls.CipherSuiteName(suite), tls.VersionTLS12, suite)
+			}
+		})
+	}
+}
+
+// BenchmarkMTLS compares mutual TLS with one way TLS, both verifying
+// certificates, in handshakes and in transfers over an established
+// connection.
+func BenchmarkMTLS(b *testing.B) {
+	transports := []struct {
+		name string
+		new  func() (Transport, error)
+	}{
+		{"tls", func() (Transport, error) { return TransportByName("tls") }},
+		{"mtls", func() (Transport, error) { return NewMTLSTransport(NewTCPTransport(), DefaultKeyType, MTLSOptions{}) }},
+		{"mtls-ocsp", func() (Transport, error) {
+			return NewMTLSTransport(NewTCPTransport(), DefaultKeyType, MTLSOptions{OCSPStaple: true})
+		}},
+		{"mtls-crl", func() (Transport, error) {
+			return NewMTLSTransport(NewTCPTransport(), DefaultKeyType, MTLSOptions{RevokedCerts: 10000})
+		}},
+	}
+
+	b.Run("Handshake", func(b *testing.B) {
+		for _, tr := range transports {
+			b.Run(tr.name, func(b *testing.B) {
+				t, err := tr.new()
+				if err != nil {
+					b.Fatal(err)
+				}
+				benchHandshake(b, t, false)
+			})
+		}
+	})
+
+	b.Run("Conn", func(b *testing.B) {
+		for _, tr := range transports[:2] {
+			b.Run(tr.name, func(b *testing.B) {
+				t, err := tr.new()
+				if err != nil {
+					b.Fatal(err)
+				}
+				ss, cs, err := ConnPair(t)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer ss.Close()
+				defer cs.Close()
+				benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+			})
+		}
+	})
+}
+
+// BenchmarkTLSSuite runs the handshake and transfer benchmarks per TLS
+// version and suite over DefaultKeyType. TLS 1.3 suites are not configurable,
+// the one crypto/tls picks is in the name. The aes-hw metric is 1 when the
+// suite is AES-GCM and the CPU has AES instructions, 0 when it runs in
+// software or is ChaCha20-Poly1305.
+func BenchmarkTLSSuite(b *testing.B) {
+	for _, c := range []struct {
+		version uint16
+		suite   uint16
+	}{
+		{tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		{tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		{tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256},
+		{tls.VersionTLS13, 0},
+	} {
+		server, client, err := DefaultTLSConfig()
+		if err != nil {
+			b.Fatal(err)
+		}
+		server.SessionTicketsDisabled = true
+		client.MinVersion, client.MaxVersion = c.version, c.version
+		if c.suite != 0 {
+			client.CipherSuites = []uint16{c.suite}
+		}
+		t, err := NewTLSTransport(NewTCPTransport(), server, client)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ss, cs, err := ConnPair(t)
+		if err != nil {
+			b.Fatal(err)
+		}
+		suite := cs.(*tls.Conn).ConnectionState().CipherSuite
+		aes := 0.0
+		if aesHardware && strings.Contains(tls.CipherSuiteName(suite), "_AES_") {
+			aes = 1
+		}
+
+		name := "TLS12/" + tls.CipherSuiteName(suite)
+		if c.version == tls.VersionTLS13 {
+			name = "TLS13/" + tls.CipherSuiteName(suite)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.Run("Handshake", func(b *testing.B) {
+				benchHandshake(b, t, false)
+				b.ReportMetric(aes, "aes-hw")
+			})
+			benchSizes(b, func(b *testing.B, size int) {
+				bench(b, cs, ss, size)
+				b.ReportMetric(aes, "aes-hw")
+			})
+		})
+		ss.Close()
+		cs.Close()
+	}
 }
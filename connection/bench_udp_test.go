@@ -0,0 +1,186 @@
+package connection
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// UDPSizes are the datagram sizes of BenchmarkUDP, up to the largest IPv4
+// payload. 1472 fills an Ethernet frame.
+var UDPSizes = []int{64, 256, 1 << 10, 1472, 8 << 10, 32 << 10, 65507}
+
+// udpBatch is the number of datagrams per WriteBatch and ReadBatch.
+const udpBatch = 64
+
+// udpIdle is how long the receiver waits for more datagrams once the sender
+// is done, the rest are lost.
+const udpIdle = 50 * time.Millisecond
+
+// BenchmarkUDP sends b.N sequence stamped datagrams over loopback as fast as
+// possible, one per syscall or in batches with sendmmsg/recvmmsg. ns/op, MB/s
+// and tx-pkts/s are the send rate, pkts/s and rx-MB/s the received one, with
+// the loss and reordering. Loss here comes from the receive buffer
+// overflowing.
+func BenchmarkUDP(b *testing.B) {
+	for _, mode := range []string{"Single", "Batch"} {
+		b.Run(mode, func(b *testing.B) {
+			for _, size := range UDPSizes {
+				b.Run(SizeName(size), func(b *testing.B) { benchUDP(b, size, mode == "Batch") })
+			}
+		})
+	}
+}
+
+func benchUDP(b *testing.B, size int, batch bool) {
+	rc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rc.Close()
+	wc, err := net.DialUDP("udp4", nil, rc.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer wc.Close()
+
+	var (
+		stats DatagramStats
+		last  time.Time
+		sent  = make(chan struct{})
+		done  = make(chan error, 1)
+	)
+	receive := udpReader(rc, size)
+	if batch {
+		receive = udpBatchReader(rc, size)
+	}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+
+	go func() {
+		finished := false
+		for stats.Received < int64(b.N) {
+			if finished {
+				rc.SetReadDeadline(time.Now().Add(udpIdle))
+			}
+			err := receive(&stats)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+			last = time.Now()
+			select {
+			case <-sent:
+				finished = true
+			default:
+			}
+		}
+		done <- nil
+	}()
+
+	if batch {
+		err = udpBatchWrite(wc, b.N, size)
+	} else {
+		err = udpWrite(wc, b.N, size)
+	}
+	// The wait for the datagrams still in flight is not timed, it is
+	// udpIdle long whenever one is lost.
+	b.StopTimer()
+	txEnd := time.Now()
+	if err != nil {
+		b.Fatal(err)
+	}
+	close(sent)
+	// Wake the receiver up when the last datagrams were lost.
+	rc.SetReadDeadline(time.Now().Add(udpIdle))
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+	if stats.Received == 0 {
+		b.Fatal("no datagram received")
+	}
+
+	b.ReportMetric(float64(b.N)/txEnd.Sub(start).Seconds(), "tx-pkts/s")
+	elapsed := last.Sub(start).Seconds()
+	b.ReportMetric(float64(stats.Received)/elapsed, "pkts/s")
+	b.ReportMetric(float64(stats.Received)*float64(size)/1e6/elapsed, "rx-MB/s")
+	b.ReportMetric(100*stats.LossRate(int64(b.N)), "loss-%")
+	b.ReportMetric(float64(stats.Reordered), "reordered")
+}
+
+func udpWrite(conn *net.UDPConn, n, size int) error {
+	buf := make([]byte, size)
+	for i := 0; i < n; i++ {
+		StampDatagram(buf, uint64(i))
+		_, err := conn.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func udpBatchWrite(conn *net.UDPConn, n, size int) error {
+	pc := ipv4.NewPacketConn(conn)
+	ms := make([]ipv4.Message, udpBatch)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, size)}
+	}
+	for i := 0; i < n; {
+		batch := ms
+		if n-i < len(batch) {
+			batch = batch[:n-i]
+		}
+		for j := range batch {
+			StampDatagram(batch[j].Buffers[0], uint64(i+j))
+		}
+		for len(batch) > 0 {
+			k, err := pc.WriteBatch(batch, 0)
+			if err != nil {
+				return err
+			}
+			batch = batch[k:]
+			i += k
+		}
+	}
+	return nil
+}
+
+func udpReader(conn *net.UDPConn, size int) func(*DatagramStats) error {
+	buf := make([]byte, size)
+	return func(stats *DatagramStats) error {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		stats.Add(buf[:n])
+		return nil
+	}
+}
+
+func udpBatchReader(conn *net.UDPConn, size int) func(*DatagramStats) error {
+	pc := ipv4.NewPacketConn(conn)
+	ms := make([]ipv4.Message, udpBatch)
+	for i := range ms {
+		ms[i].Buffers = [][]byte{make([]byte, size)}
+	}
+	return func(stats *DatagramStats) error {
+		n, err := pc.ReadBatch(ms, 0)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms[:n] {
+			stats.Add(m.Buffers[0][:m.N])
+		}
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+package connection
+
+import "testing"
+
+func BenchmarkConnUnix(b *testing.B) {
+	b.Run("Stream", func(b *testing.B) {
+		cs, ss, err := getUnixConnPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer cs.Close()
+		defer ss.Close()
+		benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+	})
+
+	b.Run("Seqpacket", func(b *testing.B) {
+		cs, ss, err := getUnixPacketConnPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer cs.Close()
+		defer ss.Close()
+		benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+	})
+}
+
+func BenchmarkEchoUnix(b *testing.B) {
+	for _, t := range []Transport{NewUnixTransport(), NewUnixPacketTransport()} {
+		b.Run(unixSocketName(t), func(b *testing.B) {
+			lis, err := t.Listen("")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer lis.Close()
+
+			go serveEcho(lis)
+			benchSizes(b, func(b *testing.B, size int) {
+				benchEcho(b, t.Dial, lis.Addr().String(), size)
+			})
+		})
+	}
+}
+
+// unixSocketName gives "Stream" or "Seqpacket".
+func unixSocketName(t Transport) string {
+	if t.Name() == "unixpacket" {
+		return "Seqpacket"
+	}
+	return "Stream"
+}
+
+// unixBenchName names benchmarks layered over t, "OverUnix" or
+// "OverUnixPacket".
+func unixBenchName(t Transport) string {
+	if t.Name() == "unixpacket" {
+		return "OverUnixPacket"
+	}
+	return "OverUnix"
+}
@@ -0,0 +1,78 @@
+package connection
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/yamux"
+)
+
+func BenchmarkConnYamux(b *testing.B) {
+	b.Run("OverTCP", func(b *testing.B) {
+		cs, ss, mux, err := getTCPYamuxStreamPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer mux.Close()
+		defer cs.Close()
+		defer ss.Close()
+		benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+	})
+
+	b.Run("OverTLS", func(b *testing.B) {
+		cs, ss, mux, err := getTLSYamuxStreamPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer mux.Close()
+		defer cs.Close()
+		defer ss.Close()
+		benchSizes(b, func(b *testing.B, size int) { bench(b, cs, ss, size) })
+	})
+}
+
+func BenchmarkEchoYamux(b *testing.B) {
+	b.Run("OverTCP", func(b *testing.B) {
+		cs, ss, err := getTCPConnPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchEchoYamux(b, cs, ss)
+	})
+
+	b.Run("OverTLS", func(b *testing.B) {
+		conn0, conn1, err := getTLSConnPair()
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchEchoYamux(b, conn0, conn1)
+	})
+}
+
+func benchEchoYamux(b *testing.B, conn0, conn1 net.Conn) {
+	defer conn1.Close()
+	defer conn0.Close()
+
+	config := yamux.DefaultConfig()
+	config.LogOutput = io.Discard
+	cs, _ := yamux.Client(conn0, config)
+	ss, _ := yamux.Server(conn1, config)
+
+	go serveEcho(ss)
+	benchSizes(b, func(b *testing.B, size int) {
+		benchEcho(b, func(s string) (net.Conn, error) { return cs.Open() }, "", size)
+	})
+}
+
+func getTCPYamuxStreamPair() (net.Conn, net.Conn, io.Closer, error) {
+	return muxConnPair(NewYamuxTransport(NewTCPTransport(), nil))
+}
+
+func getTLSYamuxStreamPair() (net.Conn, net.Conn, io.Closer, error) {
+	t, err := NewTLSTransport(NewTCPTransport(), nil, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return muxConnPair(NewYamuxTransport(t, nil))
+}
@@ -0,0 +1,272 @@
+package connection
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+// KeyTypes lists the key types known by GenerateKey.
+var KeyTypes = []string{"rsa2048", "rsa4096", "ecdsa-p256", "ecdsa-p384", "ed25519"}
+
+// CertHost is the name the leaf certificates are issued for, besides the
+// loopback addresses.
+const CertHost = "localhost"
+
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "rsa2048":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "rsa4096":
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case "ecdsa-p256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ecdsa-p384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, errors.New("unknown key type " + keyType)
+}
+
+// CA is a certificate authority issuing leaf certificates for tests and
+// benchmarks.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+	Pool *x509.CertPool // holding Cert only
+}
+
+func NewCA(keyType string) (*CA, error) {
+	key, err := GenerateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := certTemplate("benchmark CA")
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	crt, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(crt)
+	return &CA{Cert: crt, Key: key, Pool: pool}, nil
+}
+
+// Issue makes a leaf certificate of keyType for CertHost and the loopback
+// addresses, usable by servers and clients.
+func (ca *CA) Issue(keyType string) (tls.Certificate, error) {
+	key, err := GenerateKey(keyType)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl, err := certTemplate(CertHost)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl.DNSNames = []string{CertHost}
+	tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+func certTemplate(cn string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+	}, nil
+}
+
+type certPKI struct {
+	ca     *CA
+	leaf   tls.Certificate
+	client tls.Certificate
+}
+
+var (
+	pkiMu    sync.Mutex
+	pkiCache = make(map[string]certPKI)
+)
+
+// cachedPKI generates a CA, a server and a client leaf of keyType once per
+// process, RSA 4096 keys take seconds.
+func cachedPKI(keyType string) (certPKI, error) {
+	pkiMu.Lock()
+	defer pkiMu.Unlock()
+	if p, ok := pkiCache[keyType]; ok {
+		return p, nil
+	}
+	ca, err := NewCA(keyType)
+	if err != nil {
+		return certPKI{}, err
+	}
+	leaf, err := ca.Issue(keyType)
+	if err != nil {
+		return certPKI{}, err
+	}
+	client, err := ca.Issue(keyType)
+	if err != nil {
+		return certPKI{}, err
+	}
+	p := certPKI{ca: ca, leaf: leaf, client: client}
+	pkiCache[keyType] = p
+	return p, nil
+}
+
+// TLSConfigs returns new configs with a CA and a server certificate of
+// keyType generated once per process, the client verifies the server
+// against the CA.
+func TLSConfigs(keyType string) (server *tls.Config, client *tls.Config, err error) {
+	p, err := cachedPKI(keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{p.leaf}},
+		&tls.Config{RootCAs: p.ca.Pool, ServerName: CertHost}, nil
+}
+
+// MTLSOptions are the checks of MTLSConfigs besides the chain verification.
+type MTLSOptions struct {
+	// OCSPStaple makes the server staple a CA signed statement that its
+	// certificate is not revoked, which the client requires and checks. It
+	// stands in for an OCSP response: a CRL without entries, signed and
+	// verified the same way.
+	OCSPStaple bool
+	// RevokedCerts is the number of entries of a CA signed CRL both sides
+	// check the peer certificate against, no CRL when 0. The CRL is parsed
+	// once as a server would, every handshake looks the certificate up.
+	RevokedCerts int
+}
+
+// MTLSConfigs is TLSConfigs with client certificates: the client presents
+// another leaf of the CA and the server requires and verifies it.
+func MTLSConfigs(keyType string, opts MTLSOptions) (server *tls.Config, client *tls.Config, err error) {
+	p, err := cachedPKI(keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	server = &tls.Config{Certificates: []tls.Certificate{p.leaf}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: p.ca.Pool}
+	client = &tls.Config{Certificates: []tls.Certificate{p.client}, RootCAs: p.ca.Pool, ServerName: CertHost}
+
+	if opts.OCSPStaple {
+		staple, err := p.ca.RevocationList(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		server.Certificates[0].OCSPStaple = staple
+	}
+	var revoked map[string]bool
+	if opts.RevokedCerts > 0 {
+		serials := make([]*big.Int, opts.RevokedCerts)
+		for i := range serials {
+			serials[i], err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		der, err := p.ca.RevocationList(serials)
+		if err != nil {
+			return nil, nil, err
+		}
+		revoked, err = p.ca.parseRevocationList(der)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	checkRevoked := func(cs tls.ConnectionState) error {
+		if revoked[cs.PeerCertificates[0].SerialNumber.String()] {
+			return errors.New("certificate revoked")
+		}
+		return nil
+	}
+	server.VerifyConnection = checkRevoked
+	client.VerifyConnection = func(cs tls.ConnectionState) error {
+		if opts.OCSPStaple {
+			if len(cs.OCSPResponse) == 0 {
+				return errors.New("no stapled status")
+			}
+			staple, err := p.ca.parseRevocationList(cs.OCSPResponse)
+			if err != nil {
+				return err
+			}
+			if staple[cs.PeerCertificates[0].SerialNumber.String()] {
+				return errors.New("certificate revoked")
+			}
+		}
+		return checkRevoked(cs)
+	}
+	return server, client, nil
+}
+
+// RevocationList returns a DER CRL of ca revoking serials, valid for a day.
+func (ca *CA) RevocationList(serials []*big.Int) ([]byte, error) {
+	now := time.Now()
+	tmpl := &x509.RevocationList{Number: big.NewInt(now.UnixNano()), ThisUpdate: now, NextUpdate: now.Add(24 * time.Hour)}
+	for _, serial := range serials {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: now})
+	}
+	return x509.CreateRevocationList(rand.Reader, tmpl, ca.Cert, ca.Key)
+}
+
+// parseRevocationList checks a CRL of ca and returns its revoked serials.
+func (ca *CA) parseRevocationList(der []byte) (map[string]bool, error) {
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+	err = crl.CheckSignatureFrom(ca.Cert)
+	if err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(crl.NextUpdate) {
+		return nil, errors.New("expired revocation list")
+	}
+	revoked := make(map[string]bool, len(crl.RevokedCertificateEntries))
+	for _, rc := range crl.RevokedCertificateEntries {
+		revoked[rc.SerialNumber.String()] = true
+	}
+	return revoked, nil
+}
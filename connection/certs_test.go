@@ -0,0 +1,118 @@
+package connection
+
+import (
+	"crypto/tls"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConfigs(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		t.Run(keyType, func(t *testing.T) {
+			if keyType == "rsa4096" && testing.Short() {
+				t.Skip("slow key generation")
+			}
+			server, client, err := TLSConfigs(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr, err := NewTLSTransport(NewTCPTransport(), server, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ss, cs, err := ConnPair(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ss.Close()
+			defer cs.Close()
+			state := cs.(*tls.Conn).ConnectionState()
+			assert.Len(t, state.VerifiedChains, 1, "server not verified")
+		})
+	}
+
+	server, _, err := TLSConfigs("ecdsa-p256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewCA("ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTLSTransport(NewTCPTransport(), server, &tls.Config{RootCAs: ca.Pool, ServerName: CertHost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := tr.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	_, err = tr.Dial(lis.Addr().String())
+	assert.Error(t, err, "certificate of another CA")
+}
+
+func TestMTLS(t *testing.T) {
+	tr, err := NewMTLSTransport(NewTCPTransport(), DefaultKeyType, MTLSOptions{OCSPStaple: true, RevokedCerts: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "mtls", tr.Name(), "invalid name")
+	ss, cs, err := ConnPair(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	defer cs.Close()
+	assert.Len(t, ss.(*tls.Conn).ConnectionState().VerifiedChains, 1, "client not verified")
+	assert.NotEmpty(t, cs.(*tls.Conn).ConnectionState().OCSPResponse, "no stapled status")
+
+	// A client without certificate.
+	server, _, err := MTLSConfigs(DefaultKeyType, MTLSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, client, err := TLSConfigs(DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = NewTLSTransport(NewTCPTransport(), server, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// With TLS 1.3 the client only gets the alert after its handshake.
+	ss, cs, err = ConnPair(tr)
+	if err == nil {
+		defer ss.Close()
+		defer cs.Close()
+		_, err = cs.Read(make([]byte, 1))
+	}
+	assert.Error(t, err, "client certificate not required")
+
+	p, err := cachedPKI(DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := p.ca.RevocationList([]*big.Int{p.client.Leaf.SerialNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := p.ca.parseRevocationList(der)
+	assert.NoError(t, err, "invalid revocation list")
+	assert.True(t, revoked[p.client.Leaf.SerialNumber.String()], "serial not revoked")
+	other, err := NewCA(DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.parseRevocationList(der)
+	assert.Error(t, err, "revocation list of another CA")
+}
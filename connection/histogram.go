@@ -0,0 +1,137 @@
+package connection
+
+import (
+	"math/bits"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Sub-buckets per power of two, values are kept with a relative error
+// below 1/histSubBuckets.
+const (
+	histSubBits    = 7
+	histSubBuckets = 1 << histSubBits
+)
+
+// Histogram records durations in log-linear buckets as HdrHistogram does,
+// so tail latencies are kept at a fixed precision with a bounded memory.
+// It is not safe for concurrent use, record per goroutine and Merge.
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func histIndex(v uint64) int {
+	if v < histSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - histSubBits - 1
+	return (shift+1)*histSubBuckets + int(v>>shift) - histSubBuckets
+}
+
+// histUpper is the highest value recorded in bucket i.
+func histUpper(i int) uint64 {
+	if i < histSubBuckets {
+		return uint64(i)
+	}
+	shift := i/histSubBuckets - 1
+	sub := uint64(i%histSubBuckets + histSubBuckets)
+	return (sub+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := histIndex(uint64(d))
+	if i >= len(h.counts) {
+		counts := make([]uint64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		counts := make([]uint64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.sum += o.sum
+}
+
+func (h *Histogram) Count() uint64      { return h.count }
+func (h *Histogram) Min() time.Duration { return h.min }
+func (h *Histogram) Max() time.Duration { return h.max }
+
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Quantile returns the value at q (0 to 1), as the highest value of its
+// bucket, no more than Max.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var n uint64
+	for i, c := range h.counts {
+		n += c
+		if n >= rank {
+			if v := time.Duration(histUpper(i)); v < h.max {
+				return v
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// LatencyQuantiles are the quantiles reported by benchmarks and connbench.
+var LatencyQuantiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// QuantileName gives "p50", "p99.9" etc.
+func QuantileName(q float64) string {
+	return "p" + strconv.FormatFloat(q*100, 'g', 6, 64)
+}
+
+// reportLatency adds the latency quantiles and max to the benchmark result.
+func reportLatency(b *testing.B, h *Histogram) {
+	for _, q := range LatencyQuantiles {
+		b.ReportMetric(float64(h.Quantile(q)), QuantileName(q)+"-ns")
+	}
+	b.ReportMetric(float64(h.Max()), "max-ns")
+}
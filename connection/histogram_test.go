@@ -0,0 +1,42 @@
+package connection
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	var h, h2 Histogram
+	values := make([]time.Duration, 0, 20000)
+	for i := 0; i < cap(values); i++ {
+		d := time.Duration(rand.ExpFloat64() * float64(100*time.Microsecond))
+		values = append(values, d)
+		if i%2 == 0 {
+			h.Record(d)
+		} else {
+			h2.Record(d)
+		}
+	}
+	h.Merge(&h2)
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	assert.Equal(t, uint64(len(values)), h.Count(), "invalid count")
+	assert.Equal(t, values[0], h.Min(), "invalid min")
+	assert.Equal(t, values[len(values)-1], h.Max(), "invalid max")
+	for _, q := range append(LatencyQuantiles, 1) {
+		want := values[int(q*float64(len(values))+0.5)-1]
+		got := h.Quantile(q)
+		assert.True(t, got >= want && float64(got-want) <= float64(want)/histSubBuckets, "invalid %s: %v, want %v", QuantileName(q), got, want)
+	}
+
+	for v := uint64(0); v < 1<<20; v += 7 {
+		i := histIndex(v)
+		assert.True(t, v <= histUpper(i) && (i == 0 || v > histUpper(i-1)), "invalid bucket of %d", v)
+	}
+	assert.Equal(t, "p90", QuantileName(0.9), "invalid name")
+	assert.Equal(t, "p99.9", QuantileName(0.999), "invalid name")
+}
@@ -0,0 +1,221 @@
+package connection
+
+import (
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Impairment is a network link for ImpairConn to emulate, in the direction
+// of the writes: wrap both sides, as NewImpairedTransport does, for both
+// directions. The zero value is a clean link.
+type Impairment struct {
+	Latency   time.Duration // one way delay
+	Jitter    time.Duration // random extra delay up to Jitter, the order is kept
+	Bandwidth int64         // in bytes per second, no limit when 0
+
+	// Loss is the probability a packet of impairMSS bytes is lost, on a
+	// stream its retransmission stalls it and the data behind for Stall.
+	Loss  float64
+	Stall time.Duration
+}
+
+const (
+	impairMSS = 1460
+	// impairChunk is the most data delivered at once.
+	impairChunk = 16 << 10
+	// impairBuffer is the most data in flight, writes block beyond as they
+	// would on a full socket buffer.
+	impairBuffer = 4 << 20
+	// impairLinger bounds how long Close waits for the data in flight.
+	impairLinger = time.Second
+)
+
+// ImpairConn delays the writes on conn as imp says, they are delivered in
+// order by a goroutine. Reads are left as is.
+func ImpairConn(conn net.Conn, imp Impairment) net.Conn {
+	c := &impairedConn{Conn: conn, imp: imp, done: make(chan struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	go c.deliver()
+	return c
+}
+
+// ImpairListener impairs the accepted connections with ImpairConn.
+func ImpairListener(lis net.Listener, imp Impairment) net.Listener {
+	return &impairedListener{Listener: lis, imp: imp}
+}
+
+type impairedListener struct {
+	net.Listener
+	imp Impairment
+}
+
+func (l *impairedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return ImpairConn(conn, l.imp), nil
+}
+
+type impairedChunk struct {
+	data []byte
+	at   time.Time
+}
+
+type impairedConn struct {
+	net.Conn
+	imp  Impairment
+	done chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []impairedChunk
+	queued int
+	txEnd  time.Time // when the link is done sending the queued data
+	last   time.Time // delivery time of the last chunk
+	err    error
+	closed bool
+}
+
+func (c *impairedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var written int
+	for len(b) > 0 {
+		for c.queued >= impairBuffer && c.err == nil && !c.closed {
+			c.cond.Wait()
+		}
+		if c.err != nil {
+			return written, c.err
+		}
+		if c.closed {
+			return written, net.ErrClosed
+		}
+
+		n := len(b)
+		if n > impairChunk {
+			n = impairChunk
+		}
+		c.queue = append(c.queue, impairedChunk{data: append([]byte(nil), b[:n]...), at: c.schedule(n)})
+		c.queued += n
+		c.cond.Broadcast()
+		b = b[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// schedule returns when n bytes written now are delivered.
+func (c *impairedConn) schedule(n int) time.Time {
+	now := time.Now()
+	if c.txEnd.Before(now) {
+		c.txEnd = now
+	}
+	if c.imp.Bandwidth > 0 {
+		c.txEnd = c.txEnd.Add(time.Duration(int64(n) * int64(time.Second) / c.imp.Bandwidth))
+	}
+
+	at := c.txEnd.Add(c.imp.Latency)
+	if c.imp.Jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(c.imp.Jitter))))
+	}
+	if c.imp.Loss > 0 {
+		packets := float64((n + impairMSS - 1) / impairMSS)
+		if rand.Float64() < 1-math.Pow(1-c.imp.Loss, packets) {
+			at = at.Add(c.imp.Stall)
+		}
+	}
+	if at.Before(c.last) {
+		at = c.last
+	}
+	c.last = at
+	return at
+}
+
+func (c *impairedConn) deliver() {
+	defer close(c.done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		for len(c.queue) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if len(c.queue) == 0 {
+			return
+		}
+
+		chunk := c.queue[0]
+		c.mu.Unlock()
+		if d := time.Until(chunk.at); d > 0 {
+			time.Sleep(d)
+		}
+		_, err := c.Conn.Write(chunk.data)
+		c.mu.Lock()
+
+		c.queue[0] = impairedChunk{}
+		c.queue = c.queue[1:]
+		c.queued -= len(chunk.data)
+		if err != nil {
+			c.err, c.queue, c.queued = err, nil, 0
+		}
+		c.cond.Broadcast()
+	}
+}
+
+// Close delivers the data in flight first, for up to impairLinger after the
+// last of it is due.
+func (c *impairedConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	deadline := c.last
+	if now := time.Now(); deadline.Before(now) {
+		deadline = now
+	}
+	deadline = deadline.Add(impairLinger)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	c.Conn.SetWriteDeadline(deadline)
+	select {
+	case <-c.done:
+	case <-time.After(time.Until(deadline)):
+	}
+	return c.Conn.Close()
+}
+
+type impairedTransport struct {
+	under Transport
+	imp   Impairment
+}
+
+// NewImpairedTransport impairs both sides of the connections of under. To
+// impair the connection shared by a mux, wrap the transport under the mux.
+func NewImpairedTransport(under Transport, imp Impairment) Transport {
+	return &impairedTransport{under: under, imp: imp}
+}
+
+func (t *impairedTransport) Name() string { return "impaired+" + t.under.Name() }
+
+func (t *impairedTransport) Listen(addr string) (net.Listener, error) {
+	lis, err := t.under.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return ImpairListener(lis, t.imp), nil
+}
+
+func (t *impairedTransport) Dial(addr string) (net.Conn, error) {
+	conn, err := t.under.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return ImpairConn(conn, t.imp), nil
+}
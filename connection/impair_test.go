@@ -0,0 +1,42 @@
+package connection
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpairment(t *testing.T) {
+	tr := NewImpairedTransport(NewTCPTransport(), Impairment{Latency: 10 * time.Millisecond, Jitter: 5 * time.Millisecond})
+	assert.Equal(t, "impaired+tcp", tr.Name(), "invalid name")
+	lis, err := tr.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go serveEcho(lis)
+
+	// Data stays in order with jitter, a round trip takes both latencies.
+	req := makePayload(1 << 20)
+	start := time.Now()
+	_, err = echoOnce(tr.Dial, lis.Addr().String(), req, make([]byte, len(req)))
+	assert.NoError(t, err, "echo failed")
+	assert.True(t, time.Since(start) >= 20*time.Millisecond, "latency not applied")
+
+	ss, cs, err := ConnPair(NewImpairedTransport(NewTCPTransport(), Impairment{Bandwidth: 1 << 20}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	start = time.Now()
+	go func() {
+		cs.Write(make([]byte, 256<<10))
+		cs.Close()
+	}()
+	n, err := io.Copy(io.Discard, ss)
+	assert.NoError(t, err, "read failed")
+	assert.Equal(t, int64(256<<10), n, "data lost on close")
+	assert.True(t, time.Since(start) >= 200*time.Millisecond, "bandwidth not limited")
+}
@@ -0,0 +1,460 @@
+package connection
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	ModeThroughput = "throughput" // one way transfer, Size bytes per write
+	ModeEcho       = "echo"       // request/response of Size bytes each
+)
+
+// HTTPTargets are the echo only targets known by Run besides TransportNames.
+var HTTPTargets = []string{"http", "fasthttp"}
+
+// Scenario is one cell of the benchmark matrix run by Run.
+type Scenario struct {
+	Transport   string // a TransportNames or HTTPTargets entry
+	Mode        string
+	Size        int
+	Concurrency int // parallel connections, streams on mux transports
+	Duration    time.Duration
+	Verify      bool // send random payloads and check the echoed ones
+
+	// Rate makes the load open-loop: Rate ops per second are scheduled
+	// whether earlier ones are done or not, and shared by the connections.
+	// Latency is measured from the scheduled time, so the time an op waits
+	// for a busy connection is counted too (coordinated omission).
+	Rate float64
+}
+
+type Result struct {
+	Scenario
+	Bytes      int64
+	Ops        int64
+	ShortReads int64 // reads that came short of a response, on transports
+	Elapsed    time.Duration
+	Allocs     uint64    // by the whole process, both sides are in it
+	Latency    Histogram // of every op, a write in throughput mode
+	PerConn    []int64   // ops done by each connection or stream
+}
+
+func (r Result) MBPerSec() float64 {
+	return float64(r.Bytes) / 1e6 / r.Elapsed.Seconds()
+}
+
+func (r Result) OpsPerSec() float64 {
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+// Saturated tells an open-loop run did not keep up with the requested rate,
+// achieving less than 95% of it.
+func (r Result) Saturated() bool {
+	return r.Rate > 0 && r.OpsPerSec() < 0.95*r.Rate
+}
+
+// Fairness is Jain's index of PerConn: 1 when every connection did the
+// same, down to 1/len(PerConn) when one did all.
+func (r Result) Fairness() float64 { return jainIndex(r.PerConn) }
+
+func jainIndex(xs []int64) float64 {
+	var sum, sq float64
+	for _, x := range xs {
+		sum += float64(x)
+		sq += float64(x) * float64(x)
+	}
+	if sq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(xs)) * sq)
+}
+
+func (r Result) AllocsPerOp() float64 {
+	if r.Ops == 0 {
+		return 0
+	}
+	return float64(r.Allocs) / float64(r.Ops)
+}
+
+func (r Result) ShortReadsPerOp() float64 {
+	if r.Ops == 0 {
+		return 0
+	}
+	return float64(r.ShortReads) / float64(r.Ops)
+}
+
+// echoTarget is a server with clients doing one round trip per Echo.
+type echoTarget interface {
+	start() error
+	Addr() string
+	NewClient() (echoClient, error)
+	Close() error
+}
+
+type echoClient interface {
+	// Echo sends req and reads the response into resp, of the same size,
+	// it returns the number of short reads when they are known.
+	Echo(req, resp []byte) (int, error)
+	Close() error
+}
+
+// Run runs s for s.Duration and measures it.
+func Run(s Scenario) (Result, error) {
+	if s.Size <= 0 {
+		s.Size = BufSize
+	}
+	if s.Concurrency <= 0 {
+		s.Concurrency = 1
+	}
+	if s.Duration <= 0 {
+		s.Duration = time.Second
+	}
+
+	var target echoTarget
+	switch s.Transport {
+	case "http":
+		target = newNetHTTPTarget()
+	case "fasthttp":
+		target = newFastHTTPTarget()
+	default:
+		t, err := TransportByName(s.Transport)
+		if err != nil {
+			return Result{}, err
+		}
+		if c, ok := t.(io.Closer); ok {
+			defer c.Close()
+		}
+		target = &transportTarget{t: t, sink: s.Mode == ModeThroughput}
+	}
+	if s.Mode != ModeEcho && s.Mode != ModeThroughput {
+		return Result{}, errors.New("unknown mode " + s.Mode)
+	}
+	if s.Mode == ModeThroughput {
+		if _, ok := target.(*transportTarget); !ok {
+			return Result{}, errors.New(s.Transport + " only supports echo")
+		}
+		if s.Rate > 0 {
+			return Result{}, errors.New("rate only applies to echo")
+		}
+	}
+
+	err := target.start()
+	if err != nil {
+		return Result{}, err
+	}
+	defer target.Close()
+
+	clients := make([]echoClient, s.Concurrency)
+	for i := range clients {
+		clients[i], err = target.NewClient()
+		if err != nil {
+			for _, c := range clients[:i] {
+				c.Close()
+			}
+			return Result{}, err
+		}
+	}
+
+	var (
+		ms0, ms1 runtime.MemStats
+		perConn  = make([]int64, len(clients))
+		short    int64
+		errOnce  sync.Once
+		runErr   error
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		latency  Histogram
+		next     int64 // of the scheduled ops in open-loop
+	)
+	runtime.ReadMemStats(&ms0)
+	start := time.Now()
+	deadline := start.Add(s.Duration)
+	for i, c := range clients {
+		wg.Add(1)
+		go func(c echoClient, ops *int64) {
+			defer wg.Done()
+			defer c.Close()
+
+			req := make([]byte, s.Size)
+			if s.Verify {
+				rand.Read(req)
+			}
+			var resp []byte
+			if s.Mode == ModeEcho {
+				resp = make([]byte, s.Size)
+			}
+			var h Histogram
+			defer func() {
+				mu.Lock()
+				latency.Merge(&h)
+				mu.Unlock()
+			}()
+
+			interval := time.Duration(0)
+			if s.Rate > 0 {
+				interval = time.Duration(float64(time.Second) / s.Rate)
+			}
+			for {
+				begin := time.Now()
+				if interval > 0 {
+					k := atomic.AddInt64(&next, 1) - 1
+					begin = start.Add(time.Duration(k) * interval)
+					// The backlog of a saturated run is dropped at the deadline.
+					if !begin.Before(deadline) || !time.Now().Before(deadline) {
+						return
+					}
+					if d := time.Until(begin); d > 0 {
+						time.Sleep(d)
+					}
+				} else if !begin.Before(deadline) {
+					return
+				}
+
+				n, err := c.Echo(req, resp)
+				if err == nil && s.Verify && resp != nil && !bytes.Equal(req, resp) {
+					err = ErrEchoMismatch
+				}
+				if err != nil {
+					errOnce.Do(func() { runErr = err })
+					return
+				}
+				atomic.AddInt64(&short, int64(n))
+				h.Record(time.Since(begin))
+				*ops++
+			}
+		}(c, &perConn[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&ms1)
+	if runErr != nil {
+		return Result{}, runErr
+	}
+	var ops int64
+	for _, n := range perConn {
+		ops += n
+	}
+
+	r := Result{
+		Scenario:   s,
+		Ops:        ops,
+		ShortReads: short,
+		Bytes:      ops * int64(s.Size),
+		Elapsed:    elapsed,
+		Allocs:     ms1.Mallocs - ms0.Mallocs,
+		Latency:    latency,
+		PerConn:    perConn,
+	}
+	if s.Mode == ModeEcho {
+		r.Bytes *= 2
+	}
+	return r, nil
+}
+
+// transportTarget echoes, or only reads when sink is set, over a Transport.
+type transportTarget struct {
+	t    Transport
+	sink bool
+	lis  net.Listener
+}
+
+func (tt *transportTarget) start() error {
+	lis, err := tt.t.Listen("")
+	if err != nil {
+		return err
+	}
+	tt.lis = lis
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if tt.sink {
+					io.Copy(io.Discard, conn)
+				} else {
+					io.Copy(conn, conn)
+				}
+			}()
+		}
+	}()
+	return nil
+}
+
+func (tt *transportTarget) Addr() string { return tt.lis.Addr().String() }
+func (tt *transportTarget) Close() error { return tt.lis.Close() }
+
+func (tt *transportTarget) NewClient() (echoClient, error) {
+	conn, err := tt.t.Dial(tt.Addr())
+	if err != nil {
+		return nil, err
+	}
+	return &connClient{conn: conn}, nil
+}
+
+type connClient struct{ conn net.Conn }
+
+// Echo only writes when resp is nil.
+func (c *connClient) Echo(req, resp []byte) (int, error) {
+	if resp == nil {
+		_, err := c.conn.Write(req)
+		return 0, err
+	}
+	return writeRead(c.conn, req, resp)
+}
+
+func (c *connClient) Close() error { return c.conn.Close() }
+
+type netHTTPTarget struct {
+	lis net.Listener
+	srv *http.Server
+}
+
+func newNetHTTPTarget() *netHTTPTarget {
+	h := http.NewServeMux()
+	h.HandleFunc("/", echoHTTP)
+	return &netHTTPTarget{srv: &http.Server{Handler: h}}
+}
+
+// echoHTTP writes the request body back with its Content-Length. HTTP/1.x
+// bodies must be read before the response is written.
+func echoHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+func (ht *netHTTPTarget) start() error {
+	lis, err := NewTCPTransport().Listen("")
+	if err != nil {
+		return err
+	}
+	ht.lis = lis
+	go ht.srv.Serve(lis)
+	return nil
+}
+
+func (ht *netHTTPTarget) Addr() string { return ht.lis.Addr().String() }
+func (ht *netHTTPTarget) Close() error { return ht.srv.Close() }
+
+// NewClient gives every client its own keep-alive connection.
+func (ht *netHTTPTarget) NewClient() (echoClient, error) {
+	return &netHTTPClient{
+		url: "http://" + ht.Addr() + "/",
+		c:   &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 1}},
+	}, nil
+}
+
+type netHTTPClient struct {
+	url string
+	c   *http.Client
+}
+
+func (c *netHTTPClient) Echo(req, resp []byte) (int, error) {
+	r, err := c.c.Post(c.url, "application/octet-stream", bytes.NewReader(req))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return 0, errors.New("unexpected status " + r.Status)
+	}
+	if r.ContentLength != int64(len(resp)) {
+		return 0, errors.New("unexpected content length " + strconv.FormatInt(r.ContentLength, 10))
+	}
+	_, err = io.ReadFull(r.Body, resp)
+	return 0, err
+}
+
+func (c *netHTTPClient) Close() error {
+	c.c.CloseIdleConnections()
+	return nil
+}
+
+type fastHTTPTarget struct {
+	lis net.Listener
+	srv *fasthttp.Server
+}
+
+func newFastHTTPTarget() *fastHTTPTarget {
+	return &fastHTTPTarget{srv: &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) { ctx.SetBody(ctx.PostBody()) },
+	}}
+}
+
+func (ft *fastHTTPTarget) start() error {
+	lis, err := NewTCPTransport().Listen("")
+	if err != nil {
+		return err
+	}
+	ft.lis = lis
+	go ft.srv.Serve(lis)
+	return nil
+}
+
+func (ft *fastHTTPTarget) Addr() string { return ft.lis.Addr().String() }
+func (ft *fastHTTPTarget) Close() error { return ft.lis.Close() }
+
+// NewClient gives every client its own keep-alive connection.
+func (ft *fastHTTPTarget) NewClient() (echoClient, error) {
+	return &fastHTTPClient{
+		url: "http://" + ft.Addr() + "/",
+		c:   &fasthttp.HostClient{Addr: ft.Addr(), MaxConns: 1},
+	}, nil
+}
+
+// fastHTTPClient posts with any of the fasthttp clients.
+type fastHTTPClient struct {
+	url string
+	c   interface {
+		Do(req *fasthttp.Request, resp *fasthttp.Response) error
+	}
+}
+
+func (c *fastHTTPClient) Echo(req, resp []byte) (int, error) {
+	r := fasthttp.AcquireRequest()
+	w := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(r)
+	defer fasthttp.ReleaseResponse(w)
+
+	r.SetRequestURI(c.url)
+	r.Header.SetMethod(fasthttp.MethodPost)
+	r.SetBodyRaw(req)
+	err := c.c.Do(r, w)
+	if err != nil {
+		return 0, err
+	}
+	if w.StatusCode() != fasthttp.StatusOK {
+		return 0, errors.New("unexpected status " + strconv.Itoa(w.StatusCode()))
+	}
+	if len(w.Body()) != len(resp) {
+		return 0, errors.New("unexpected content length " + strconv.Itoa(len(w.Body())))
+	}
+	copy(resp, w.Body())
+	return 0, nil
+}
+
+func (c *fastHTTPClient) Close() error {
+	if ci, ok := c.c.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package connection
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	for _, s := range []Scenario{
+		{Transport: "tcp", Mode: ModeThroughput, Size: 1024, Concurrency: 2},
+		{Transport: "smux+tls", Mode: ModeEcho, Size: 1024, Concurrency: 2},
+		{Transport: "http", Mode: ModeEcho, Size: 4096},
+		{Transport: "fasthttp", Mode: ModeEcho, Size: 4096},
+	} {
+		s.Duration = 50 * time.Millisecond
+		s.Verify = true
+		r, err := Run(s)
+		if err != nil {
+			t.Fatal(s.Transport, err)
+		}
+		assert.True(t, r.Ops > 0, "no ops done")
+		assert.True(t, r.Elapsed >= s.Duration, "invalid elapsed time")
+		assert.True(t, r.MBPerSec() > 0, "invalid throughput")
+	}
+
+	_, err := Run(Scenario{Transport: "http", Mode: ModeThroughput})
+	assert.Error(t, err, "throughput over http")
+	_, err = Run(Scenario{Transport: "tcp", Mode: ModeThroughput, Rate: 100})
+	assert.Error(t, err, "open-loop throughput")
+}
+
+func TestRunRate(t *testing.T) {
+	s := Scenario{Transport: "tcp", Mode: ModeEcho, Size: 64, Concurrency: 2, Duration: 200 * time.Millisecond, Rate: 1000}
+	r, err := Run(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, r.Ops <= 200, "more ops than scheduled")
+	// Only half of the ops are required, a loaded machine may fall behind.
+	assert.True(t, r.Ops >= 100, "too few ops")
+	assert.Equal(t, uint64(r.Ops), r.Latency.Count(), "latency of every op")
+
+	r = Result{Scenario: Scenario{Rate: 1000}, Ops: 200, Elapsed: 200 * time.Millisecond}
+	assert.False(t, r.Saturated(), "saturated at the requested rate")
+	r.Ops = 150
+	assert.True(t, r.Saturated(), "not saturated below the requested rate")
+}
+
+func TestEchoVerify(t *testing.T) {
+	lis, err := NewTCPTransport().Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			// Echo in pieces, with the last byte changed.
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				io.ReadFull(conn, buf)
+				buf[len(buf)-1]++
+				for i := 0; i < len(buf); i += 1024 {
+					conn.Write(buf[i : i+1024])
+					time.Sleep(time.Millisecond)
+				}
+			}(conn)
+		}
+	}()
+
+	req := makePayload(4096)
+	short, err := echoOnce(NewTCPTransport().Dial, lis.Addr().String(), req, make([]byte, len(req)))
+	assert.Equal(t, ErrEchoMismatch, err, "mismatch not found")
+	assert.True(t, short > 0, "short reads not counted")
+
+	_, err = readFull(bytes.NewReader(req[:10]), make([]byte, 20))
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "short data")
+}
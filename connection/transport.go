@@ -0,0 +1,177 @@
+package connection
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+)
+
+// Transport sets up connections the same way the benchmarks do, so services
+// and tools can measure and use the exact same stacks.
+//
+// Listen with an empty addr listens on a random loopback port.
+type Transport interface {
+	Name() string
+	Listen(addr string) (net.Listener, error)
+	Dial(addr string) (net.Conn, error)
+}
+
+type tcpTransport struct{}
+
+func NewTCPTransport() Transport { return tcpTransport{} }
+
+func (tcpTransport) Name() string { return "tcp" }
+
+func (tcpTransport) Listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		addr = "localhost:0"
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (tcpTransport) Dial(addr string) (net.Conn, error) { return net.Dial("tcp", addr) }
+
+type tlsTransport struct {
+	layer  string
+	under  Transport
+	server *tls.Config
+	client *tls.Config
+}
+
+// NewTLSTransport runs TLS over under, nil configs take DefaultTLSConfig.
+func NewTLSTransport(under Transport, server, client *tls.Config) (Transport, error) {
+	if server == nil || client == nil {
+		s, c, err := DefaultTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		if server == nil {
+			server = s
+		}
+		if client == nil {
+			client = c
+		}
+	}
+	return &tlsTransport{layer: "tls", under: under, server: server, client: client}, nil
+}
+
+// NewMTLSTransport runs mutual TLS over under with MTLSConfigs.
+func NewMTLSTransport(under Transport, keyType string, opts MTLSOptions) (Transport, error) {
+	server, client, err := MTLSConfigs(keyType, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tlsTransport{layer: "mtls", under: under, server: server, client: client}, nil
+}
+
+func (t *tlsTransport) Name() string { return layerName(t.layer, t.under) }
+
+func (t *tlsTransport) Listen(addr string) (net.Listener, error) {
+	lis, err := t.under.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(lis, t.server), nil
+}
+
+// Dial returns after the handshake is done.
+func (t *tlsTransport) Dial(addr string) (net.Conn, error) {
+	conn, err := t.under.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	tc := tls.Client(conn, t.client)
+	err = tc.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// DefaultKeyType is the key type of DefaultTLSConfig.
+const DefaultKeyType = "ecdsa-p256"
+
+// DefaultTLSConfig is TLSConfigs of DefaultKeyType.
+func DefaultTLSConfig() (server *tls.Config, client *tls.Config, err error) {
+	return TLSConfigs(DefaultKeyType)
+}
+
+// layerName names a transport layered over another one, TLS over TCP is
+// simply "tls" and mutual TLS "mtls".
+func layerName(layer string, under Transport) string {
+	if under.Name() == "tcp" && (layer == "tls" || layer == "mtls") {
+		return layer
+	}
+	return layer + "+" + under.Name()
+}
+
+// TransportNames lists the names known by TransportByName.
+var TransportNames = []string{
+	"tcp", "tls", "mtls", "unix", "unixpacket", "quic",
+	"smux+tcp", "smux+tls", "smux+unix", "smux+unixpacket",
+	"yamux+tcp", "yamux+tls",
+	"cmux+tcp", "cmux+tls", "cmux+unix", "cmux+unixpacket",
+}
+
+// TransportByName builds a transport from its name with the default
+// settings: a generated DefaultKeyType certificate for TLS, client ones too
+// for mTLS, the default smux and yamux configs and the PacketMagic header for
+// cmux.
+func TransportByName(name string) (Transport, error) {
+	layers := strings.Split(name, "+")
+	var t Transport
+	switch base := layers[len(layers)-1]; base {
+	case "tcp":
+		t = NewTCPTransport()
+	case "unix":
+		t = NewUnixTransport()
+	case "unixpacket":
+		t = NewUnixPacketTransport()
+	case "quic":
+		var err error
+		t, err = NewQUICTransport(nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	case "tls":
+		var err error
+		t, err = NewTLSTransport(NewTCPTransport(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	case "mtls":
+		var err error
+		t, err = NewMTLSTransport(NewTCPTransport(), DefaultKeyType, MTLSOptions{})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown transport " + name)
+	}
+
+	for i := len(layers) - 2; i >= 0; i-- {
+		switch layers[i] {
+		case "smux":
+			t = NewSmuxTransport(t, nil)
+		case "yamux":
+			t = NewYamuxTransport(t, nil)
+		case "cmux":
+			t = NewCmuxTransport(t, PacketMagicMatcher, PacketMagicHeader())
+		default:
+			return nil, errors.New("unknown transport " + name)
+		}
+	}
+	return t, nil
+}
+
+// ConnPair returns the server and client side of a new connection over t.
+func ConnPair(t Transport) (net.Conn, net.Conn, error) {
+	lis, err := t.Listen("")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lis.Close()
+	return getConnPair(func() (net.Listener, error) { return lis, nil }, t.Dial)
+}
@@ -0,0 +1,325 @@
+package connection
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/hashicorp/yamux"
+	"github.com/soheilhy/cmux"
+	"github.com/xtaci/smux"
+)
+
+const (
+	PacketMagic = 0x00114514
+	PacketToken = "xyz_token"
+)
+
+func PacketMagicMatcher(r io.Reader) bool {
+	buf := make([]byte, 4)
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return false
+	}
+	return binary.BigEndian.Uint32(buf[:n]) == PacketMagic
+}
+
+func PacketTokenMatcher(r io.Reader) bool {
+	buf := make([]byte, len(PacketToken))
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return false
+	}
+	return string(buf[:n]) == PacketToken
+}
+
+// PacketMagicHeader is what PacketMagicMatcher matches.
+func PacketMagicHeader() []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, PacketMagic)
+	return buf
+}
+
+type cmuxTransport struct {
+	under   Transport
+	matcher cmux.Matcher
+	header  []byte
+}
+
+// NewCmuxTransport serves the connections matched by matcher, Dial sends
+// header first and accepted connections skip it before the first read.
+func NewCmuxTransport(under Transport, matcher cmux.Matcher, header []byte) Transport {
+	return &cmuxTransport{under: under, matcher: matcher, header: header}
+}
+
+func (t *cmuxTransport) Name() string { return layerName("cmux", t.under) }
+
+// Listen returns the matched listener, closing it closes the whole mux.
+func (t *cmuxTransport) Listen(addr string) (net.Listener, error) {
+	lis, err := t.under.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	m := cmux.New(lis)
+	l := m.Match(t.matcher)
+	go m.Serve()
+	return &headerListener{Listener: l, n: len(t.header)}, nil
+}
+
+func (t *cmuxTransport) Dial(addr string) (net.Conn, error) {
+	conn, err := t.under.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(t.header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+type headerListener struct {
+	net.Listener
+	n int
+}
+
+func (l *headerListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &headerConn{Conn: conn, skip: int64(l.n)}, nil
+}
+
+// headerConn skips the header lazily, so a slow client does not block Accept.
+type headerConn struct {
+	net.Conn
+	skip int64
+}
+
+func (c *headerConn) Read(b []byte) (int, error) {
+	if c.skip > 0 {
+		n, err := io.CopyN(io.Discard, c.Conn, c.skip)
+		c.skip -= n
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+// muxSession is a multiplexed session, Accept and Open give streams.
+type muxSession interface {
+	net.Listener
+	Open() (net.Conn, error)
+	IsClosed() bool
+}
+
+type SmuxSession struct{ *smux.Session }
+
+func (s *SmuxSession) Addr() net.Addr            { return s.Session.LocalAddr() }
+func (s *SmuxSession) Accept() (net.Conn, error) { return s.Session.AcceptStream() }
+func (s *SmuxSession) Open() (net.Conn, error)   { return s.Session.OpenStream() }
+func (s *SmuxSession) Close() error              { return s.Session.Close() }
+
+// NewSmuxTransport runs smux over under, a nil config takes the default one.
+// See muxTransport for how sessions are used.
+func NewSmuxTransport(under Transport, config *smux.Config) Transport {
+	return &muxTransport{
+		name: layerName("smux", under),
+		dial: func(addr string) (muxSession, error) {
+			conn, err := under.Dial(addr)
+			if err != nil {
+				return nil, err
+			}
+			s, err := smux.Client(conn, config)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return &SmuxSession{Session: s}, nil
+		},
+		listen: func(addr string) (sessionListener, error) {
+			lis, err := under.Listen(addr)
+			if err != nil {
+				return nil, err
+			}
+			return &connSessionListener{Listener: lis, server: func(conn net.Conn) (muxSession, error) {
+				s, err := smux.Server(conn, config)
+				if err != nil {
+					return nil, err
+				}
+				return &SmuxSession{Session: s}, nil
+			}}, nil
+		},
+		sessions: make(map[string]muxSession),
+	}
+}
+
+// NewYamuxTransport runs yamux over under, a nil config takes the default
+// one without logging. See muxTransport for how sessions are used.
+func NewYamuxTransport(under Transport, config *yamux.Config) Transport {
+	if config == nil {
+		config = yamux.DefaultConfig()
+		config.LogOutput = io.Discard
+	}
+	return &muxTransport{
+		name: layerName("yamux", under),
+		dial: func(addr string) (muxSession, error) {
+			conn, err := under.Dial(addr)
+			if err != nil {
+				return nil, err
+			}
+			s, err := yamux.Client(conn, config)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return s, nil
+		},
+		listen: func(addr string) (sessionListener, error) {
+			lis, err := under.Listen(addr)
+			if err != nil {
+				return nil, err
+			}
+			return &connSessionListener{Listener: lis, server: func(conn net.Conn) (muxSession, error) {
+				return yamux.Server(conn, config)
+			}}, nil
+		},
+		sessions: make(map[string]muxSession),
+	}
+}
+
+// sessionListener accepts sessions, as a net.Listener accepts connections.
+type sessionListener interface {
+	Accept() (muxSession, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// connSessionListener runs server on the connections of a listener.
+type connSessionListener struct {
+	net.Listener
+	server func(net.Conn) (muxSession, error)
+}
+
+func (l *connSessionListener) Accept() (muxSession, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		s, err := l.server(conn)
+		if err == nil {
+			return s, nil
+		}
+		conn.Close()
+	}
+}
+
+// muxTransport opens streams over one client session per address, the
+// session is made again when it gets closed. The listener accepts streams of
+// every session it accepts.
+//
+// It also implements io.Closer, which closes the client sessions.
+type muxTransport struct {
+	name     string
+	dial     func(addr string) (muxSession, error)
+	listen   func(addr string) (sessionListener, error)
+	mu       sync.Mutex
+	sessions map[string]muxSession
+}
+
+func (t *muxTransport) Name() string { return t.name }
+
+func (t *muxTransport) Dial(addr string) (net.Conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[addr]
+	if !ok || s.IsClosed() {
+		var err error
+		s, err = t.dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		t.sessions[addr] = s
+	}
+	return s.Open()
+}
+
+func (t *muxTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, s := range t.sessions {
+		s.Close()
+		delete(t.sessions, addr)
+	}
+	return nil
+}
+
+// Listen returns a listener of streams. Like a TCP listener, closing it
+// does not close the sessions already accepted.
+func (t *muxTransport) Listen(addr string) (net.Listener, error) {
+	lis, err := t.listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	ml := &muxListener{sessions: lis, conns: make(chan net.Conn), done: make(chan struct{})}
+	go ml.serve()
+	return ml, nil
+}
+
+type muxListener struct {
+	sessions sessionListener
+	conns    chan net.Conn
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (l *muxListener) serve() {
+	for {
+		s, err := l.sessions.Accept()
+		if err != nil {
+			l.Close()
+			return
+		}
+		go l.serveSession(s)
+	}
+}
+
+func (l *muxListener) serveSession(s muxSession) {
+	for {
+		stream, err := s.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case l.conns <- stream:
+		case <-l.done:
+			stream.Close()
+		}
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *muxListener) Addr() net.Addr { return l.sessions.Addr() }
+
+func (l *muxListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.sessions.Close()
+	})
+	return err
+}
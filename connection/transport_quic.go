@@ -0,0 +1,120 @@
+package connection
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// QUICProto is the ALPN protocol of the QUIC transport.
+const QUICProto = "connection-bench"
+
+// NewQUICTransport runs QUIC streams over UDP, with TLS 1.3 from the
+// configs, nil ones take DefaultTLSConfig, and the quic-go defaults besides a
+// higher stream limit when config is nil. As with smux, Dial opens a stream
+// on one connection per address, see muxTransport.
+func NewQUICTransport(server, client *tls.Config, config *quic.Config) (Transport, error) {
+	if server == nil || client == nil {
+		s, c, err := DefaultTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		if server == nil {
+			server = s
+		}
+		if client == nil {
+			client = c
+		}
+	}
+	server, client = server.Clone(), client.Clone()
+	if len(server.NextProtos) == 0 {
+		server.NextProtos = []string{QUICProto}
+	}
+	if len(client.NextProtos) == 0 {
+		client.NextProtos = []string{QUICProto}
+	}
+	if config == nil {
+		config = &quic.Config{MaxIncomingStreams: 1 << 10}
+	}
+
+	return &muxTransport{
+		name: "quic",
+		dial: func(addr string) (muxSession, error) {
+			conn, err := quic.DialAddr(context.Background(), addr, client, config)
+			if err != nil {
+				return nil, err
+			}
+			return &quicSession{conn: conn}, nil
+		},
+		listen: func(addr string) (sessionListener, error) {
+			if addr == "" {
+				addr = "localhost:0"
+			}
+			lis, err := quic.ListenAddr(addr, server, config)
+			if err != nil {
+				return nil, err
+			}
+			return quicListener{lis}, nil
+		},
+		sessions: make(map[string]muxSession),
+	}, nil
+}
+
+type quicListener struct{ *quic.Listener }
+
+func (l quicListener) Accept() (muxSession, error) {
+	conn, err := l.Listener.Accept(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &quicSession{conn: conn}, nil
+}
+
+type quicSession struct{ conn *quic.Conn }
+
+func (s *quicSession) Addr() net.Addr { return s.conn.LocalAddr() }
+func (s *quicSession) IsClosed() bool { return s.conn.Context().Err() != nil }
+func (s *quicSession) Close() error   { return s.conn.CloseWithError(0, "") }
+
+// A peer only learns of a QUIC stream with its first frame, so Open sends a
+// byte that Accept skips, as headerConn does for cmux.
+var quicStreamOpen = []byte{0}
+
+func (s *quicSession) Open() (net.Conn, error) {
+	stream, err := s.conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	_, err = stream.Write(quicStreamOpen)
+	if err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	return &quicStream{Stream: stream, conn: s.conn}, nil
+}
+
+func (s *quicSession) Accept() (net.Conn, error) {
+	stream, err := s.conn.AcceptStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &headerConn{Conn: &quicStream{Stream: stream, conn: s.conn}, skip: int64(len(quicStreamOpen))}, nil
+}
+
+// quicStream is a net.Conn, Close closes both directions where a QUIC
+// stream Close only closes the write one.
+type quicStream struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+func (s *quicStream) LocalAddr() net.Addr  { return s.conn.LocalAddr() }
+func (s *quicStream) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+func (s *quicStream) Close() error {
+	s.Stream.CancelRead(0)
+	return s.Stream.Close()
+}
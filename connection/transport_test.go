@@ -0,0 +1,85 @@
+package connection
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransports(t *testing.T) {
+	for _, name := range TransportNames {
+		t.Run(name, func(t *testing.T) {
+			tr, err := TransportByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, name, tr.Name(), "invalid name")
+			if c, ok := tr.(io.Closer); ok {
+				defer c.Close()
+			}
+
+			lis, err := tr.Listen("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			go func() {
+				for {
+					conn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					go func(conn net.Conn) {
+						defer conn.Close()
+						io.Copy(conn, conn)
+					}(conn)
+				}
+			}()
+
+			for i := 0; i < 3; i++ {
+				conn, err := tr.Dial(lis.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				msg := []byte("hello " + name)
+				conn.Write(msg)
+				buf := make([]byte, len(msg))
+				_, err = io.ReadFull(conn, buf)
+				assert.NoError(t, err, "read failed")
+				assert.Equal(t, msg, buf, "invalid echo")
+				conn.Close()
+			}
+		})
+	}
+
+	_, err := TransportByName("smux+udp")
+	assert.Error(t, err, "unknown transport")
+}
+
+func TestUnixPacketConn(t *testing.T) {
+	ss, cs, err := ConnPair(NewUnixPacketTransport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	defer cs.Close()
+
+	// Larger than a message and read in pieces smaller than one.
+	data := makePayload(3*unixPacketSize + 100)
+	go cs.Write(data)
+	buf := make([]byte, len(data))
+	for i := 0; i < len(buf); {
+		end := i + 1000
+		if end > len(buf) {
+			end = len(buf)
+		}
+		n, err := ss.Read(buf[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		i += n
+	}
+	assert.Equal(t, data, buf, "data mismatch")
+}
@@ -0,0 +1,109 @@
+package connection
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+)
+
+type unixTransport struct{ network string }
+
+// NewUnixTransport uses Unix stream sockets.
+func NewUnixTransport() Transport { return unixTransport{network: "unix"} }
+
+// NewUnixPacketTransport uses Unix seqpacket sockets, with the stream
+// semantics of packetConn on top.
+func NewUnixPacketTransport() Transport { return unixTransport{network: "unixpacket"} }
+
+func (t unixTransport) Name() string { return t.network }
+
+var unixSockets int64
+
+// Listen with an empty addr listens on a new socket in the temporary
+// directory, it is removed on Close.
+func (t unixTransport) Listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		n := atomic.AddInt64(&unixSockets, 1)
+		addr = filepath.Join(os.TempDir(), "connection-"+strconv.Itoa(os.Getpid())+"-"+strconv.FormatInt(n, 10)+".sock")
+	}
+	lis, err := net.Listen(t.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.network == "unixpacket" {
+		return packetListener{lis}, nil
+	}
+	return lis, nil
+}
+
+func (t unixTransport) Dial(addr string) (net.Conn, error) {
+	conn, err := net.Dial(t.network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.network == "unixpacket" {
+		return &packetConn{Conn: conn}, nil
+	}
+	return conn, nil
+}
+
+type packetListener struct{ net.Listener }
+
+func (l packetListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &packetConn{Conn: conn}, nil
+}
+
+// unixPacketSize is the largest message written on seqpacket sockets, it
+// has to fit in the socket send buffer.
+const unixPacketSize = 64 << 10
+
+// packetConn gives a seqpacket connection stream semantics: writes are split
+// in messages and what does not fit in a read is kept for the next ones,
+// where the socket would drop it.
+type packetConn struct {
+	net.Conn
+	buf     []byte
+	pending []byte
+}
+
+func (c *packetConn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		if len(b) >= unixPacketSize {
+			return c.Conn.Read(b)
+		}
+		if c.buf == nil {
+			c.buf = make([]byte, unixPacketSize)
+		}
+		n, err := c.Conn.Read(c.buf)
+		if n == 0 {
+			return 0, err
+		}
+		c.pending = c.buf[:n]
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *packetConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		m := b
+		if len(m) > unixPacketSize {
+			m = m[:unixPacketSize]
+		}
+		n, err := c.Conn.Write(m)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,42 @@
+package connection
+
+import "encoding/binary"
+
+// DatagramSeqSize is the size of the sequence number StampDatagram puts at
+// the start of datagrams.
+const DatagramSeqSize = 8
+
+func StampDatagram(b []byte, seq uint64) {
+	binary.BigEndian.PutUint64(b, seq)
+}
+
+// DatagramStats tracks datagrams stamped by StampDatagram to measure loss
+// and reordering.
+type DatagramStats struct {
+	Received  int64
+	Reordered int64 // received after one with a higher sequence number
+	Truncated int64 // too short to hold a sequence number
+	next      uint64
+}
+
+func (s *DatagramStats) Add(b []byte) {
+	if len(b) < DatagramSeqSize {
+		s.Truncated++
+		return
+	}
+	s.Received++
+	seq := binary.BigEndian.Uint64(b)
+	if seq < s.next {
+		s.Reordered++
+	} else {
+		s.next = seq + 1
+	}
+}
+
+// LossRate is the share of sent datagrams that were not received.
+func (s *DatagramStats) LossRate(sent int64) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return float64(sent-s.Received) / float64(sent)
+}
@@ -0,0 +1,21 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatagramStats(t *testing.T) {
+	var s DatagramStats
+	buf := make([]byte, 16)
+	for _, seq := range []uint64{0, 1, 3, 2, 5, 4, 6} {
+		StampDatagram(buf, seq)
+		s.Add(buf)
+	}
+	s.Add(buf[:4])
+	assert.Equal(t, int64(7), s.Received, "invalid received")
+	assert.Equal(t, int64(2), s.Reordered, "invalid reordered")
+	assert.Equal(t, int64(1), s.Truncated, "invalid truncated")
+	assert.Equal(t, 0.5, s.LossRate(14), "invalid loss rate")
+}
@@ -1,25 +1,30 @@
 module benchmark
 
-go 1.18
+go 1.24
 
 require (
+	github.com/hashicorp/yamux v0.1.2
+	github.com/quic-go/quic-go v0.59.1
 	github.com/soheilhy/cmux v0.1.5
-	github.com/stretchr/testify v1.6.1
+	github.com/stretchr/testify v1.11.1
 	github.com/valyala/fasthttp v1.47.0
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	github.com/xtaci/smux v1.5.24
+	golang.org/x/net v0.43.0
+	golang.org/x/sys v0.35.0
 )
 
 require (
 	github.com/andybalholm/brotli v1.0.5 // indirect
-	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/klauspost/compress v1.16.3 // indirect
+	github.com/kr/text v0.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	golang.org/x/net v0.8.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.26.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
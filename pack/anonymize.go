@@ -0,0 +1,343 @@
+package pack
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+)
+
+// PayloadMode tells what Anonymizer does with the bytes after L4 headers.
+type PayloadMode int
+
+const (
+	PayloadKeep     PayloadMode = iota // keep payloads as they are
+	PayloadZero                        // overwrite payloads with zeros
+	PayloadTruncate                    // cut payloads off, Length keeps the wire size
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	ipProtoICMP   = 1
+	ipProtoTCP    = 6
+	ipProtoUDP    = 17
+	ipProtoICMPv6 = 58
+
+	maxAnonymizeCache = 1 << 16
+)
+
+// Anonymizer scrubs Ethernet frames before they are shared.
+//
+// IPv4/IPv6 addresses (including ARP) are anonymized prefix-preservingly with
+// Crypto-PAn: two addresses sharing a n-bit prefix still share exactly a
+// n-bit prefix afterwards, and the same key always gives the same mapping.
+// Payloads beyond TCP/UDP/ICMP headers are handled by PayloadMode, with the
+// IPv4 header and L4 checksums recomputed to match.
+type Anonymizer struct {
+	block   cipher.Block
+	pad     [16]byte
+	payload PayloadMode
+	cache   [2]map[[16]byte][16]byte // IPv4, IPv6
+}
+
+// NewAnonymizer takes a 32 bytes key, the first half is the AES key and the
+// second half makes the pad.
+func NewAnonymizer(key []byte, mode PayloadMode) (*Anonymizer, error) {
+	if len(key) != 32 {
+		return nil, errors.New("anonymizer key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Anonymizer{block: block, payload: mode}
+	block.Encrypt(a.pad[:], key[16:])
+	for i := range a.cache {
+		a.cache[i] = make(map[[16]byte][16]byte)
+	}
+	return a, nil
+}
+
+// Transform rewrites p.Data in place, and sets CaptureLength to len(p.Data).
+func (a *Anonymizer) Transform(p *CapturePacket) error {
+	data := p.Data
+	end := len(data)
+
+	if len(data) >= 14 {
+		off := 14
+		etype := binary.BigEndian.Uint16(data[12:])
+		for (etype == etherTypeVLAN || etype == etherTypeQinQ) && len(data) >= off+4 {
+			etype = binary.BigEndian.Uint16(data[off+2:])
+			off += 4
+		}
+
+		switch etype {
+		case etherTypeIPv4:
+			end = a.ipv4(data, off)
+		case etherTypeIPv6:
+			end = a.ipv6(data, off)
+		case etherTypeARP:
+			a.arp(data[off:])
+		default:
+			end = a.scrub(data, off)
+		}
+	}
+
+	if a.payload == PayloadTruncate {
+		p.Data = data[:end]
+	}
+	p.CaptureLength = len(p.Data)
+	if p.Length < p.CaptureLength {
+		p.Length = p.CaptureLength
+	}
+	return nil
+}
+
+// anonymize maps a 4 or 16 bytes address in place.
+func (a *Anonymizer) anonymize(addr []byte) {
+	cache := a.cache[0]
+	if len(addr) == 16 {
+		cache = a.cache[1]
+	}
+
+	var orig [16]byte
+	copy(orig[:], addr)
+	if v, ok := cache[orig]; ok {
+		copy(addr, v[:])
+		return
+	}
+
+	// Bit i of the one-time pad is the first bit of AES(the first i bits of
+	// the address followed by the pad).
+	var in, out, otp [16]byte
+	for pos := 0; pos < len(addr)*8; pos++ {
+		in = a.pad
+		n := pos / 8
+		copy(in[:n], orig[:n])
+		if rem := pos % 8; rem != 0 {
+			mask := byte(0xff << (8 - rem))
+			in[n] = orig[n]&mask | a.pad[n]&^mask
+		}
+		a.block.Encrypt(out[:], in[:])
+		otp[n] |= (out[0] >> 7) << (7 - pos%8)
+	}
+
+	var res [16]byte
+	for i := range addr {
+		res[i] = orig[i] ^ otp[i]
+	}
+	copy(addr, res[:])
+
+	if len(cache) >= maxAnonymizeCache {
+		cache = make(map[[16]byte][16]byte)
+		a.cache[len(addr)/16] = cache
+	}
+	cache[orig] = res
+}
+
+// scrub handles the payload starting at off, returns where the kept data ends.
+func (a *Anonymizer) scrub(data []byte, off int) int {
+	if a.payload == PayloadKeep || off >= len(data) {
+		return len(data)
+	}
+	for i := range data[off:] {
+		data[off+i] = 0
+	}
+	return off
+}
+
+func (a *Anonymizer) arp(arp []byte) {
+	if len(arp) < 8 || binary.BigEndian.Uint16(arp[2:]) != etherTypeIPv4 || arp[5] != 4 {
+		return
+	}
+	hlen := int(arp[4])
+	spa := 8 + hlen
+	tpa := spa + 4 + hlen
+	if len(arp) < tpa+4 {
+		return
+	}
+	a.anonymize(arp[spa : spa+4])
+	a.anonymize(arp[tpa : tpa+4])
+}
+
+func (a *Anonymizer) ipv4(data []byte, off int) int {
+	ip := data[off:]
+	if len(ip) < 20 || ip[0]>>4 != 4 {
+		return a.scrub(data, off)
+	}
+	ihl := int(ip[0]&0x0f) * 4
+	if ihl < 20 || len(ip) < ihl {
+		return a.scrub(data, off)
+	}
+
+	var old [8]byte
+	copy(old[:], ip[12:20])
+	a.anonymize(ip[12:16])
+	a.anonymize(ip[16:20])
+
+	binary.BigEndian.PutUint16(ip[10:], 0)
+	binary.BigEndian.PutUint16(ip[10:], checksumFold(checksumAdd(0, ip[:ihl])))
+
+	l4Len := int(binary.BigEndian.Uint16(ip[2:])) - ihl
+	if l4Len < 0 {
+		l4Len = 0
+	}
+	frag := binary.BigEndian.Uint16(ip[6:])
+	if frag&0x1fff != 0 {
+		// Not the first fragment, there is no L4 header.
+		return a.scrub(data, off+ihl)
+	}
+
+	pseudo := checksumAdd(0, ip[12:20])
+	pseudo += uint32(ip[9]) + uint32(l4Len)
+	return a.l4(data, off+ihl, ip[9], pseudo, old[:], ip[12:20], frag&0x2000 == 0)
+}
+
+func (a *Anonymizer) ipv6(data []byte, off int) int {
+	ip := data[off:]
+	if len(ip) < 40 || ip[0]>>4 != 6 {
+		return a.scrub(data, off)
+	}
+
+	var old [32]byte
+	copy(old[:], ip[8:40])
+	a.anonymize(ip[8:24])
+	a.anonymize(ip[24:40])
+
+	l4Len := int(binary.BigEndian.Uint16(ip[4:]))
+	next := ip[6]
+	hoff := off + 40
+	complete := true
+	for {
+		if next == 0 || next == 43 || next == 60 { // hop-by-hop, routing, destination options
+			if len(data) < hoff+2 {
+				return len(data)
+			}
+			n := (int(data[hoff+1]) + 1) * 8
+			next = data[hoff]
+			hoff += n
+			l4Len -= n
+			continue
+		}
+		if next == 44 { // fragment
+			if len(data) < hoff+8 {
+				return len(data)
+			}
+			frag := binary.BigEndian.Uint16(data[hoff+2:])
+			next = data[hoff]
+			hoff += 8
+			l4Len -= 8
+			if frag&0xfff8 != 0 {
+				return a.scrub(data, hoff)
+			}
+			complete = frag&1 == 0
+			continue
+		}
+		break
+	}
+	if hoff > len(data) {
+		return len(data)
+	}
+	if l4Len < 0 {
+		l4Len = 0
+	}
+
+	pseudo := checksumAdd(0, ip[8:40])
+	pseudo += uint32(l4Len>>16) + uint32(l4Len&0xffff) + uint32(next)
+	return a.l4(data, hoff, next, pseudo, old[:], ip[8:40], complete)
+}
+
+// l4 handles the L4 segment at off. Checksums are updated for the new
+// addresses, or recomputed as if the payload was all zeros, which gives the
+// same result when it is cut off.
+func (a *Anonymizer) l4(data []byte, off int, proto byte, pseudo uint32, oldAddr, newAddr []byte, complete bool) int {
+	seg := data[off:]
+	hlen, csumOff, withPseudo := 0, -1, true
+	switch proto {
+	case ipProtoTCP:
+		if len(seg) < 20 {
+			return len(data)
+		}
+		hlen, csumOff = int(seg[12]>>4)*4, 16
+		if hlen < 20 {
+			hlen, csumOff = 0, -1
+		}
+	case ipProtoUDP:
+		hlen, csumOff = 8, 6
+	case ipProtoICMP:
+		hlen, csumOff, withPseudo = 8, 2, false
+	case ipProtoICMPv6:
+		hlen, csumOff = 8, 2
+	}
+	if hlen > len(seg) {
+		// Header cut off by the snap length, there is no payload.
+		return len(data)
+	}
+
+	var csum uint16
+	hasCsum := csumOff >= 0
+	if hasCsum {
+		csum = binary.BigEndian.Uint16(seg[csumOff:])
+		// UDP checksum is optional over IPv4.
+		hasCsum = !(proto == ipProtoUDP && csum == 0)
+	}
+
+	if a.payload == PayloadKeep {
+		if hasCsum && withPseudo {
+			csum = checksumUpdate(csum, oldAddr, newAddr)
+			if proto == ipProtoUDP && csum == 0 {
+				csum = 0xffff
+			}
+			binary.BigEndian.PutUint16(seg[csumOff:], csum)
+		}
+		return len(data)
+	}
+
+	end := a.scrub(data, off+hlen)
+	if hasCsum && complete {
+		if !withPseudo {
+			pseudo = 0
+		}
+		binary.BigEndian.PutUint16(seg[csumOff:], 0)
+		csum = checksumFold(checksumAdd(pseudo, seg[:hlen]))
+		if proto == ipProtoUDP && csum == 0 {
+			csum = 0xffff
+		}
+		binary.BigEndian.PutUint16(seg[csumOff:], csum)
+	}
+	return end
+}
+
+func checksumAdd(sum uint32, b []byte) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+func checksumFold(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// checksumUpdate replaces from with to in the checksum, see RFC 1624.
+func checksumUpdate(csum uint16, from, to []byte) uint16 {
+	sum := uint32(^csum)
+	for i := 0; i+1 < len(from); i += 2 {
+		sum += uint32(^binary.BigEndian.Uint16(from[i:]))
+		sum += uint32(binary.BigEndian.Uint16(to[i:]))
+	}
+	return checksumFold(sum)
+}
@@ -0,0 +1,195 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testAnonymizeKey = []byte("0123456789abcdef0123456789abcdef")
+
+// makeFrame builds an Ethernet frame with a TCP (IPv4) or UDP (IPv6) segment
+// carrying payload, with valid checksums.
+func makeFrame(src, dst net.IP, payload []byte) []byte {
+	frame := make([]byte, 14)
+	var l4, pseudo []byte
+	if src.To4() != nil {
+		binary.BigEndian.PutUint16(frame[12:], etherTypeIPv4)
+		l4 = make([]byte, 20)
+		l4[12] = 5 << 4
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(l4)+len(payload)))
+		ip[8], ip[9] = 64, ipProtoTCP
+		copy(ip[12:], src.To4())
+		copy(ip[16:], dst.To4())
+		binary.BigEndian.PutUint16(ip[10:], checksumFold(checksumAdd(0, ip)))
+		frame = append(frame, ip...)
+		pseudo = append(append([]byte{}, ip[12:20]...), 0, ipProtoTCP, 0, 0)
+		binary.BigEndian.PutUint16(pseudo[10:], uint16(len(l4)+len(payload)))
+	} else {
+		binary.BigEndian.PutUint16(frame[12:], etherTypeIPv6)
+		l4 = make([]byte, 8)
+		binary.BigEndian.PutUint16(l4[4:], uint16(len(l4)+len(payload)))
+		ip := make([]byte, 40)
+		ip[0] = 6 << 4
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(l4)+len(payload)))
+		ip[6], ip[7] = ipProtoUDP, 64
+		copy(ip[8:], src.To16())
+		copy(ip[24:], dst.To16())
+		frame = append(frame, ip...)
+		pseudo = append(append([]byte{}, ip[8:40]...), 0, 0, 0, 0, 0, 0, 0, ipProtoUDP)
+		binary.BigEndian.PutUint32(pseudo[32:], uint32(len(l4)+len(payload)))
+	}
+	binary.BigEndian.PutUint16(l4[0:], 12345)
+	binary.BigEndian.PutUint16(l4[2:], 80)
+
+	seg := append(l4, payload...)
+	csumOff := 16
+	if len(l4) == 8 {
+		csumOff = 6
+	}
+	binary.BigEndian.PutUint16(seg[csumOff:], checksumFold(checksumAdd(checksumAdd(0, pseudo), seg)))
+	return append(frame, seg...)
+}
+
+// checkFrame verifies the checksums of a frame built by makeFrame, the
+// payload cut off is taken as zeros.
+func checkFrame(t *testing.T, frame []byte) {
+	if binary.BigEndian.Uint16(frame[12:]) == etherTypeIPv4 {
+		ip := frame[14:34]
+		assert.Equal(t, uint16(0), checksumFold(checksumAdd(0, ip)), "invalid ip checksum")
+		segLen := int(binary.BigEndian.Uint16(ip[2:])) - 20
+		seg := make([]byte, segLen)
+		copy(seg, frame[34:])
+		sum := checksumAdd(0, ip[12:20]) + ipProtoTCP + uint32(segLen)
+		assert.Equal(t, uint16(0), checksumFold(checksumAdd(sum, seg)), "invalid tcp checksum")
+		return
+	}
+
+	ip := frame[14:54]
+	segLen := int(binary.BigEndian.Uint16(ip[4:]))
+	seg := make([]byte, segLen)
+	copy(seg, frame[54:])
+	sum := checksumAdd(0, ip[8:40]) + ipProtoUDP + uint32(segLen)
+	assert.Equal(t, uint16(0), checksumFold(checksumAdd(sum, seg)), "invalid udp checksum")
+}
+
+func commonPrefixLen(a, b net.IP) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			n := i * 8
+			for x&0x80 == 0 {
+				x <<= 1
+				n++
+			}
+			return n
+		}
+	}
+	return len(a) * 8
+}
+
+func TestAnonymizerAddress(t *testing.T) {
+	a, err := NewAnonymizer(testAnonymizeKey, PayloadKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pair := range [][2]string{
+		{"10.1.2.3", "10.1.2.200"},
+		{"192.168.1.1", "192.168.129.1"},
+		{"2001:db8::1", "2001:db8::8000:1"},
+	} {
+		x, y := net.ParseIP(pair[0]), net.ParseIP(pair[1])
+		if v4 := x.To4(); v4 != nil {
+			x, y = v4, y.To4()
+		}
+		ax := append(net.IP{}, x...)
+		ay := append(net.IP{}, y...)
+		a.anonymize(ax)
+		a.anonymize(ay)
+
+		assert.NotEqual(t, x, ax, "address not anonymized")
+		assert.Equal(t, commonPrefixLen(x, y), commonPrefixLen(ax, ay), "prefix not preserved")
+
+		again := append(net.IP{}, x...)
+		a.anonymize(again)
+		assert.Equal(t, ax, again, "mapping must be stable")
+	}
+}
+
+func TestAnonymizerTransform(t *testing.T) {
+	payload := []byte("secret payload!")
+	for _, addrs := range [][2]string{{"10.0.0.1", "10.0.0.2"}, {"2001:db8::1", "2001:db8::2"}} {
+		src, dst := net.ParseIP(addrs[0]), net.ParseIP(addrs[1])
+		raw := src.To4()
+		if raw == nil {
+			raw = src.To16()
+		}
+		for _, mode := range []PayloadMode{PayloadKeep, PayloadZero, PayloadTruncate} {
+			a, err := NewAnonymizer(testAnonymizeKey, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			frame := makeFrame(src, dst, payload)
+			p := CapturePacket{
+				CaptureInfo: CaptureInfo{CaptureLength: len(frame), Length: len(frame)},
+				Data:        frame,
+			}
+			assert.NoError(t, a.Transform(&p), "transform failed")
+			checkFrame(t, p.Data)
+			assert.False(t, bytes.Contains(p.Data, raw), "source address left")
+			assert.Equal(t, len(p.Data), p.CaptureLength, "invalid capture length")
+			assert.Equal(t, len(frame), p.Length, "wire length must be kept")
+
+			tail := p.Data[len(p.Data)-len(payload):]
+			switch mode {
+			case PayloadKeep:
+				assert.Equal(t, payload, tail, "payload must be kept")
+			case PayloadZero:
+				assert.Equal(t, make([]byte, len(payload)), tail, "payload must be zeroed")
+			case PayloadTruncate:
+				assert.Equal(t, len(frame)-len(payload), len(p.Data), "payload must be cut off")
+			}
+		}
+	}
+}
+
+func TestAnonymizePcap(t *testing.T) {
+	a, err := NewAnonymizer(testAnonymizeKey, PayloadTruncate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := makeFrame(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), []byte("hello"))
+	in := CapturePacket{
+		CaptureInfo: CaptureInfo{
+			Timestamp:     time.UnixMicro(time.Now().UnixMicro()),
+			CaptureLength: len(frame),
+			Length:        len(frame),
+		},
+		Data: frame,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := NewTransformWriter(NewPcapWriter(buf, 65535, LinkTypeEthernet), a)
+	assert.NoError(t, w.WritePacket(&in), "write failed")
+
+	r, err := NewPcapReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, LinkTypeEthernet, r.LinkType(), "invalid link type")
+
+	out := readAllPackets(t, r)
+	assert.Equal(t, 1, len(out), "invalid packet count")
+	assert.True(t, in.Timestamp.Equal(out[0].Timestamp), "invalid timestamp")
+	assert.Equal(t, in.Data, out[0].Data, "invalid data")
+	assert.Equal(t, len(frame)-5, out[0].CaptureLength, "invalid capture length")
+	assert.Equal(t, len(frame), out[0].Length, "invalid length")
+}
@@ -0,0 +1,246 @@
+// Code generated by codecgen -type CapturePacket; DO NOT EDIT.
+
+package pack
+
+import "benchmark/pack/codec"
+
+// CapturePacketJSON encodes CapturePacket as encoding/json does, without reflection.
+var CapturePacketJSON CapturePacketJSONCodec
+
+// CapturePacketJSONCodec limits the input of Decode and DecodeSlice to its MaxFrameSize.
+type CapturePacketJSONCodec struct {
+	codec.Limits
+}
+
+func (c CapturePacketJSONCodec) Encode(p *CapturePacket) []byte {
+	return c.Append(make([]byte, 0, c.size(p)), p)
+}
+
+func (CapturePacketJSONCodec) size(p *CapturePacket) int {
+	return 184 + len(p.Data)*4/3
+}
+
+func (CapturePacketJSONCodec) Append(b []byte, p *CapturePacket) []byte {
+	start := len(b)
+	b = append(b, `,"ts":`...)
+	b = codec.AppendJSONTime(b, p.CaptureInfo.Timestamp)
+	b = append(b, `,"cap_len":`...)
+	b = codec.AppendJSONInt(b, int64(p.CaptureInfo.CaptureLength))
+	b = append(b, `,"len":`...)
+	b = codec.AppendJSONInt(b, int64(p.CaptureInfo.Length))
+	b = append(b, `,"iface_idx":`...)
+	b = codec.AppendJSONInt(b, int64(p.CaptureInfo.InterfaceIndex))
+	b = append(b, `,"id":`...)
+	b = codec.AppendJSONUint(b, uint64(p.Id))
+	b = append(b, `,"data":`...)
+	b = codec.AppendJSONBytes(b, p.Data)
+	if len(b) == start {
+		b = append(b, '{')
+	} else {
+		b[start] = '{'
+	}
+	return append(b, '}')
+}
+
+// EncodeSlice encodes ps as a JSON array, nil as null.
+func (c CapturePacketJSONCodec) EncodeSlice(ps []CapturePacket) []byte {
+	n := 2
+	for i := range ps {
+		n += c.size(&ps[i]) + 1
+	}
+	return c.AppendSlice(make([]byte, 0, n), ps)
+}
+
+func (c CapturePacketJSONCodec) AppendSlice(b []byte, ps []CapturePacket) []byte {
+	if ps == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i := range ps {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = c.Append(b, &ps[i])
+	}
+	return append(b, ']')
+}
+
+func (c CapturePacketJSONCodec) Decode(data []byte, p *CapturePacket) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	return c.decode(data, p)
+}
+
+// DecodeSlice decodes a JSON array into ps, null into nil.
+func (c CapturePacketJSONCodec) DecodeSlice(data []byte, ps *[]CapturePacket) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	var r codec.JSONReader
+	r.Reset(data)
+	if r.Null() {
+		*ps = nil
+		return r.End()
+	}
+	*ps = (*ps)[:0]
+	if *ps == nil {
+		*ps = []CapturePacket{}
+	}
+	for r.NextElement() {
+		raw := r.Raw()
+		if r.Err() != nil {
+			break
+		}
+		*ps = append(*ps, CapturePacket{})
+		if err := c.decode(raw, &(*ps)[len(*ps)-1]); err != nil {
+			return err
+		}
+	}
+	return r.End()
+}
+
+func (CapturePacketJSONCodec) decode(data []byte, p *CapturePacket) error {
+	var r codec.JSONReader
+	r.Reset(data)
+	for r.NextField() {
+		switch string(r.Key()) {
+		case "ts":
+			if !r.Null() {
+				p.CaptureInfo.Timestamp = r.Time()
+			}
+		case "cap_len":
+			if !r.Null() {
+				p.CaptureInfo.CaptureLength = int(r.Int(0))
+			}
+		case "len":
+			if !r.Null() {
+				p.CaptureInfo.Length = int(r.Int(0))
+			}
+		case "iface_idx":
+			if !r.Null() {
+				p.CaptureInfo.InterfaceIndex = int(r.Int(0))
+			}
+		case "id":
+			if !r.Null() {
+				p.Id = uint32(r.Uint(32))
+			}
+		case "data":
+			if r.Null() {
+				p.Data = nil
+			} else {
+				p.Data = r.Bytes()
+			}
+		default:
+			r.Skip()
+		}
+	}
+	return r.End()
+}
+
+// CapturePacketMsgpack encodes CapturePacket as github.com/vmihailenco/msgpack does,
+// without reflection.
+var CapturePacketMsgpack CapturePacketMsgpackCodec
+
+// CapturePacketMsgpackCodec limits the input of Decode and DecodeSlice to its MaxFrameSize.
+type CapturePacketMsgpackCodec struct {
+	codec.Limits
+}
+
+func (c CapturePacketMsgpackCodec) Encode(p *CapturePacket) []byte {
+	return c.Append(make([]byte, 0, c.size(p)), p)
+}
+
+func (CapturePacketMsgpackCodec) size(p *CapturePacket) int {
+	return 184 + len(p.Data)
+}
+
+func (CapturePacketMsgpackCodec) Append(b []byte, p *CapturePacket) []byte {
+	b = codec.AppendMsgpackMapLen(b, 6)
+	b = append(b, "\xa2ts"...)
+	b = codec.AppendMsgpackTime(b, p.CaptureInfo.Timestamp)
+	b = append(b, "\xa7cap_len"...)
+	b = codec.AppendMsgpackIntN(b, int64(p.CaptureInfo.CaptureLength), 0)
+	b = append(b, "\xa3len"...)
+	b = codec.AppendMsgpackIntN(b, int64(p.CaptureInfo.Length), 0)
+	b = append(b, "\xa9iface_idx"...)
+	b = codec.AppendMsgpackIntN(b, int64(p.CaptureInfo.InterfaceIndex), 0)
+	b = append(b, "\xa2id"...)
+	b = codec.AppendMsgpackUintN(b, uint64(p.Id), 32)
+	b = append(b, "\xa4data"...)
+	b = codec.AppendMsgpackBytes(b, p.Data)
+	return b
+}
+
+// EncodeSlice encodes ps as an array, nil as nil.
+func (c CapturePacketMsgpackCodec) EncodeSlice(ps []CapturePacket) []byte {
+	n := 5
+	for i := range ps {
+		n += c.size(&ps[i])
+	}
+	return c.AppendSlice(make([]byte, 0, n), ps)
+}
+
+func (c CapturePacketMsgpackCodec) AppendSlice(b []byte, ps []CapturePacket) []byte {
+	if ps == nil {
+		return codec.AppendMsgpackNil(b)
+	}
+	b = codec.AppendMsgpackArrayLen(b, len(ps))
+	for i := range ps {
+		b = c.Append(b, &ps[i])
+	}
+	return b
+}
+
+func (c CapturePacketMsgpackCodec) Decode(data []byte, p *CapturePacket) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	var r codec.MsgpackReader
+	r.Reset(data)
+	c.decode(&r, p)
+	return r.End()
+}
+
+// DecodeSlice decodes an array into ps, nil into nil.
+func (c CapturePacketMsgpackCodec) DecodeSlice(data []byte, ps *[]CapturePacket) error {
+	if err := c.CheckFrame(len(data)); err != nil {
+		return err
+	}
+	var r codec.MsgpackReader
+	r.Reset(data)
+	if r.Nil() {
+		*ps = nil
+		return r.End()
+	}
+	*ps = (*ps)[:0]
+	if *ps == nil {
+		*ps = []CapturePacket{}
+	}
+	for n := r.ArrayLen(); n > 0 && r.Err() == nil; n-- {
+		*ps = append(*ps, CapturePacket{})
+		c.decode(&r, &(*ps)[len(*ps)-1])
+	}
+	return r.End()
+}
+
+func (CapturePacketMsgpackCodec) decode(r *codec.MsgpackReader, p *CapturePacket) {
+	for n := r.MapLen(); n > 0 && r.Err() == nil; n-- {
+		switch string(r.Key()) {
+		case "ts":
+			p.CaptureInfo.Timestamp = r.Time()
+		case "cap_len":
+			p.CaptureInfo.CaptureLength = int(r.Int(0))
+		case "len":
+			p.CaptureInfo.Length = int(r.Int(0))
+		case "iface_idx":
+			p.CaptureInfo.InterfaceIndex = int(r.Int(0))
+		case "id":
+			p.Id = uint32(r.Uint(32))
+		case "data":
+			p.Data = r.Bytes()
+		default:
+			r.Skip()
+		}
+	}
+}
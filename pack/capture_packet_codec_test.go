@@ -0,0 +1,183 @@
+package pack
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack"
+)
+
+func assertPacketEqual(t *testing.T, want, got *CapturePacket) {
+	assert.True(t, want.Timestamp.Equal(got.Timestamp), "invalid timestamp")
+	assert.Equal(t, want.CaptureLength, got.CaptureLength, "invalid capture length")
+	assert.Equal(t, want.Length, got.Length, "invalid length")
+	assert.Equal(t, want.InterfaceIndex, got.InterfaceIndex, "invalid interface index")
+	assert.Equal(t, want.Id, got.Id, "invalid id")
+	assert.Equal(t, want.Data, got.Data, "invalid data")
+}
+
+func TestGenJsonPack(t *testing.T) {
+	for _, p := range append(packets, CapturePacket{}) {
+		want, err := json.Marshal(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(want), string(CapturePacketJSON.Encode(&p)), "encoding differs from encoding/json")
+
+		var pd CapturePacket
+		assert.NoError(t, json.Unmarshal(CapturePacketJSON.Encode(&p), &pd), "encoding/json decode failed")
+		assertPacketEqual(t, &p, &pd)
+
+		data, err := json.Marshal(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pd = CapturePacket{}
+		assert.NoError(t, CapturePacketJSON.Decode(data, &pd), "decode failed")
+		assertPacketEqual(t, &p, &pd)
+	}
+
+	var p CapturePacket
+	assert.NoError(t, CapturePacketJSON.Decode([]byte(` {"unknown": [1, {"a": null}], "id": 7, "data": null} `), &p), "decode failed")
+	assert.Equal(t, uint32(7), p.Id, "invalid id")
+	assert.Error(t, CapturePacketJSON.Decode([]byte(`{"id": -1}`), &p), "id must be unsigned")
+	assert.Error(t, CapturePacketJSON.Decode([]byte(`{"id": 1`), &p), "truncated input")
+}
+
+func TestGenMsgPack(t *testing.T) {
+	for _, p := range append(packets, CapturePacket{}) {
+		want, err := msgpack.Marshal(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, CapturePacketMsgpack.Encode(&p), "encoding differs from msgpack")
+
+		var pd CapturePacket
+		assert.NoError(t, msgpack.Unmarshal(CapturePacketMsgpack.Encode(&p), &pd), "msgpack decode failed")
+		assertPacketEqual(t, &p, &pd)
+
+		data, err := msgpack.Marshal(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pd = CapturePacket{}
+		assert.NoError(t, CapturePacketMsgpack.Decode(data, &pd), "decode failed")
+		assertPacketEqual(t, &p, &pd)
+
+		for i := 0; i < len(data); i++ {
+			assert.Error(t, CapturePacketMsgpack.Decode(data[:i], &pd), "truncated input")
+		}
+	}
+}
+
+func TestGenSlice(t *testing.T) {
+	for _, ps := range [][]CapturePacket{nil, {}, packets, append(packets, CapturePacket{})} {
+		want, err := json.Marshal(ps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(want), string(CapturePacketJSON.EncodeSlice(ps)), "encoding differs from encoding/json")
+		var pd []CapturePacket
+		assert.NoError(t, CapturePacketJSON.DecodeSlice(want, &pd), "json decode failed")
+		assertSliceEqual(t, ps, pd)
+
+		want, err = msgpack.Marshal(ps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, CapturePacketMsgpack.EncodeSlice(ps), "encoding differs from msgpack")
+		pd = []CapturePacket{{Id: 1}}
+		assert.NoError(t, CapturePacketMsgpack.DecodeSlice(want, &pd), "msgpack decode failed")
+		assertSliceEqual(t, ps, pd)
+		for i := 0; i < len(want); i++ {
+			assert.Error(t, CapturePacketMsgpack.DecodeSlice(want[:i], &pd), "truncated input")
+		}
+	}
+
+	var ps []CapturePacket
+	assert.NoError(t, CapturePacketJSON.DecodeSlice([]byte(` [ {"id": 1}, null, {"id": 3} ] `), &ps), "decode failed")
+	assert.Equal(t, 3, len(ps), "invalid length")
+	assert.Equal(t, uint32(3), ps[2].Id, "invalid id")
+	assert.Error(t, CapturePacketJSON.DecodeSlice([]byte(`[{"id": 1},]`), &ps), "trailing comma")
+	assert.Error(t, CapturePacketJSON.DecodeSlice([]byte(`[{"id": 1}`), &ps), "truncated input")
+	assert.Error(t, CapturePacketJSON.DecodeSlice([]byte(`{"id": 1}`), &ps), "not an array")
+}
+
+func assertSliceEqual(t *testing.T, want, got []CapturePacket) {
+	assert.Equal(t, want == nil, got == nil, "invalid nil slice")
+	if assert.Equal(t, len(want), len(got), "invalid length") {
+		for i := range want {
+			assertPacketEqual(t, &want[i], &got[i])
+		}
+	}
+}
+
+func BenchmarkGenJsonPack(b *testing.B) {
+	b.ReportAllocs()
+
+	for _, p := range packets {
+		b.Run("encode#"+strconv.Itoa(len(p.Data)), func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				CapturePacketJSON.Encode(&p)
+			}
+		})
+	}
+
+	for _, p := range packets {
+		b.Run("encode_with_buf#"+strconv.Itoa(len(p.Data)), func(b *testing.B) {
+			b.ResetTimer()
+			buf := make([]byte, 0, 1024*32)
+			for i := 0; i < b.N; i++ {
+				buf = CapturePacketJSON.Append(buf[:0], &p)
+			}
+		})
+	}
+
+	for _, p := range packets {
+		b.Run("decode#"+strconv.Itoa(len(p.Data)), func(b *testing.B) {
+			data := CapturePacketJSON.Encode(&p)
+			b.ResetTimer()
+			var p CapturePacket
+			for i := 0; i < b.N; i++ {
+				CapturePacketJSON.Decode(data, &p)
+			}
+		})
+	}
+}
+
+func BenchmarkGenMsgPack(b *testing.B) {
+	b.ReportAllocs()
+
+	for _, p := range packets {
+		b.Run("encode#"+strconv.Itoa(len(p.Data)), func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				CapturePacketMsgpack.Encode(&p)
+			}
+		})
+	}
+
+	for _, p := range packets {
+		b.Run("encode_with_buf#"+strconv.Itoa(len(p.Data)), func(b *testing.B) {
+			b.ResetTimer()
+			buf := make([]byte, 0, 1024*32)
+			for i := 0; i < b.N; i++ {
+				buf = CapturePacketMsgpack.Append(buf[:0], &p)
+			}
+		})
+	}
+
+	for _, p := range packets {
+		b.Run("decode#"+strconv.Itoa(len(p.Data)), func(b *testing.B) {
+			data := CapturePacketMsgpack.Encode(&p)
+			b.ResetTimer()
+			var p CapturePacket
+			for i := 0; i < b.N; i++ {
+				CapturePacketMsgpack.Decode(data, &p)
+			}
+		})
+	}
+}
@@ -0,0 +1,564 @@
+// Package codec holds the runtime helpers used by code generated with
+// cmd/codecgen, they encode and decode JSON and msgpack without reflection.
+package codec
+
+import (
+	"encoding/base64"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// MaxDepth limits the nesting of skipped values.
+const MaxDepth = 1000
+
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Msg + " at offset " + strconv.Itoa(e.Offset)
+}
+
+func grow(b []byte, n int) []byte {
+	if cap(b)-len(b) >= n {
+		return b
+	}
+	nb := make([]byte, len(b), 2*cap(b)+n)
+	copy(nb, b)
+	return nb
+}
+
+// AppendJSONString escapes s the way encoding/json does, including HTML
+// characters and invalid UTF-8.
+func AppendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', 'f', 'f', 'f', 'd')
+			i += size
+			start = i
+			continue
+		}
+		if r == 0x2028 || r == 0x2029 {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+// AppendJSONBytes encodes v as a base64 string, nil as null.
+func AppendJSONBytes(b []byte, v []byte) []byte {
+	if v == nil {
+		return append(b, "null"...)
+	}
+	n := base64.StdEncoding.EncodedLen(len(v))
+	b = grow(b, n+2)
+	b = append(b, '"')
+	base64.StdEncoding.Encode(b[len(b):len(b)+n], v)
+	b = b[:len(b)+n]
+	return append(b, '"')
+}
+
+// AppendJSONTime encodes t in RFC 3339 as time.Time.MarshalJSON does.
+func AppendJSONTime(b []byte, t time.Time) []byte {
+	b = append(b, '"')
+	b = t.AppendFormat(b, time.RFC3339Nano)
+	return append(b, '"')
+}
+
+func AppendJSONInt(b []byte, v int64) []byte   { return strconv.AppendInt(b, v, 10) }
+func AppendJSONUint(b []byte, v uint64) []byte { return strconv.AppendUint(b, v, 10) }
+func AppendJSONBool(b []byte, v bool) []byte   { return strconv.AppendBool(b, v) }
+
+// JSONReader reads the fields of a JSON object one by one, the first error
+// sticks and is returned by End. Keys are matched exactly, unlike
+// encoding/json which falls back to case-insensitive matching.
+type JSONReader struct {
+	data    []byte
+	pos     int
+	err     error
+	started bool
+	done    bool
+	key     []byte
+	buf     []byte
+}
+
+func (r *JSONReader) Reset(data []byte) {
+	buf := r.buf[:0]
+	*r = JSONReader{data: data, buf: buf}
+}
+
+func (r *JSONReader) Err() error { return r.err }
+
+func (r *JSONReader) fail(msg string) {
+	if r.err == nil {
+		r.err = &SyntaxError{Offset: r.pos, Msg: msg}
+	}
+}
+
+func (r *JSONReader) skipSpace() {
+	for r.pos < len(r.data) {
+		switch r.data[r.pos] {
+		case ' ', '\t', '\r', '\n':
+			r.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (r *JSONReader) peek() byte {
+	r.skipSpace()
+	if r.pos < len(r.data) {
+		return r.data[r.pos]
+	}
+	return 0
+}
+
+func (r *JSONReader) literal(lit string) bool {
+	r.skipSpace()
+	if len(r.data)-r.pos >= len(lit) && string(r.data[r.pos:r.pos+len(lit)]) == lit {
+		r.pos += len(lit)
+		return true
+	}
+	return false
+}
+
+// NextField reads the key of the next field, it returns false at the end of
+// the object or on error.
+func (r *JSONReader) NextField() bool {
+	if r.err != nil || r.done {
+		return false
+	}
+
+	if !r.started {
+		r.started = true
+		if r.literal("null") {
+			r.done = true
+			return false
+		}
+		if r.peek() != '{' {
+			r.fail("expected object")
+			return false
+		}
+		r.pos++
+		if r.peek() == '}' {
+			r.pos++
+			r.done = true
+			return false
+		}
+	} else {
+		switch r.peek() {
+		case ',':
+			r.pos++
+		case '}':
+			r.pos++
+			r.done = true
+			return false
+		default:
+			r.fail("expected , or }")
+			return false
+		}
+	}
+
+	r.key = r.readString()
+	if r.peek() != ':' {
+		r.fail("expected :")
+		return false
+	}
+	r.pos++
+	return r.err == nil
+}
+
+// NextElement moves to the next element of a JSON array, it returns false at
+// the end of the array or on error.
+func (r *JSONReader) NextElement() bool {
+	if r.err != nil || r.done {
+		return false
+	}
+
+	if !r.started {
+		r.started = true
+		if r.peek() != '[' {
+			r.fail("expected array")
+			return false
+		}
+		r.pos++
+		if r.peek() == ']' {
+			r.pos++
+			r.done = true
+			return false
+		}
+		return true
+	}
+	switch r.peek() {
+	case ',':
+		r.pos++
+		return true
+	case ']':
+		r.pos++
+		r.done = true
+		return false
+	}
+	r.fail("expected , or ]")
+	return false
+}
+
+// Raw consumes a value of any type and returns it as a slice of the input.
+func (r *JSONReader) Raw() []byte {
+	r.skipSpace()
+	start := r.pos
+	r.Skip()
+	return r.data[start:r.pos]
+}
+
+// Key returns the key read by NextField, valid until the next read.
+func (r *JSONReader) Key() []byte { return r.key }
+
+// End checks that the whole input was consumed.
+func (r *JSONReader) End() error {
+	if r.err == nil && !r.done {
+		r.fail("unexpected end of object")
+	}
+	if r.skipSpace(); r.err == nil && r.pos != len(r.data) {
+		r.fail("unexpected data after object")
+	}
+	return r.err
+}
+
+// Null consumes a null value. Read first, the null is the whole input.
+func (r *JSONReader) Null() bool {
+	if r.err != nil || !r.literal("null") {
+		return false
+	}
+	if !r.started {
+		r.started, r.done = true, true
+	}
+	return true
+}
+
+// readString returns the unescaped string, either a slice of the input or of
+// an internal buffer, valid until the next read.
+func (r *JSONReader) readString() []byte {
+	if r.peek() != '"' {
+		r.fail("expected string")
+		return nil
+	}
+	r.pos++
+
+	start := r.pos
+	for r.pos < len(r.data) {
+		c := r.data[r.pos]
+		if c == '"' {
+			r.pos++
+			return r.data[start : r.pos-1]
+		}
+		if c == '\\' {
+			break
+		}
+		if c < 0x20 {
+			r.fail("invalid character in string")
+			return nil
+		}
+		r.pos++
+	}
+
+	r.buf = append(r.buf[:0], r.data[start:r.pos]...)
+	for r.pos < len(r.data) {
+		c := r.data[r.pos]
+		switch {
+		case c == '"':
+			r.pos++
+			return r.buf
+		case c < 0x20:
+			r.fail("invalid character in string")
+			return nil
+		case c != '\\':
+			r.buf = append(r.buf, c)
+			r.pos++
+			continue
+		}
+
+		r.pos++
+		if r.pos >= len(r.data) {
+			break
+		}
+		c = r.data[r.pos]
+		r.pos++
+		switch c {
+		case '"', '\\', '/':
+			r.buf = append(r.buf, c)
+		case 'b':
+			r.buf = append(r.buf, '\b')
+		case 'f':
+			r.buf = append(r.buf, '\f')
+		case 'n':
+			r.buf = append(r.buf, '\n')
+		case 'r':
+			r.buf = append(r.buf, '\r')
+		case 't':
+			r.buf = append(r.buf, '\t')
+		case 'u':
+			rr, ok := r.readHex4()
+			if !ok {
+				r.fail("invalid unicode escape")
+				return nil
+			}
+			if rr >= 0xd800 && rr < 0xdc00 && len(r.data)-r.pos >= 6 && r.data[r.pos] == '\\' && r.data[r.pos+1] == 'u' {
+				save := r.pos
+				r.pos += 2
+				lo, ok := r.readHex4()
+				if ok && lo >= 0xdc00 && lo < 0xe000 {
+					rr = 0x10000 + (rr-0xd800)<<10 + (lo - 0xdc00)
+				} else {
+					r.pos = save
+				}
+			}
+			if rr >= 0xd800 && rr < 0xe000 {
+				rr = utf8.RuneError
+			}
+			r.buf = utf8.AppendRune(r.buf, rr)
+		default:
+			r.fail("invalid escape in string")
+			return nil
+		}
+	}
+	r.fail("unexpected end of string")
+	return nil
+}
+
+// readHex4 reads the 4 hex digits of a \u escape, only moving on success.
+func (r *JSONReader) readHex4() (rune, bool) {
+	if len(r.data)-r.pos < 4 {
+		return 0, false
+	}
+	var v rune
+	for _, c := range r.data[r.pos : r.pos+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			v = v<<4 | rune(c-'0')
+		case c >= 'a' && c <= 'f':
+			v = v<<4 | rune(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			v = v<<4 | rune(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	r.pos += 4
+	return v, true
+}
+
+func (r *JSONReader) String() string {
+	return string(r.readString())
+}
+
+// Bytes decodes a base64 string into a new slice.
+func (r *JSONReader) Bytes() []byte {
+	s := r.readString()
+	if r.err != nil {
+		return nil
+	}
+	v := make([]byte, base64.StdEncoding.DecodedLen(len(s)))
+	n, err := base64.StdEncoding.Decode(v, s)
+	if err != nil {
+		r.fail("invalid base64 string")
+		return nil
+	}
+	return v[:n]
+}
+
+func (r *JSONReader) Time() time.Time {
+	s := r.readString()
+	if r.err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, string(s))
+	if err != nil {
+		r.fail("invalid time")
+	}
+	return t
+}
+
+func (r *JSONReader) Bool() bool {
+	switch {
+	case r.literal("true"):
+		return true
+	case r.literal("false"):
+		return false
+	}
+	r.fail("expected bool")
+	return false
+}
+
+// readDigits returns the magnitude of an integer, fractions are rejected.
+func (r *JSONReader) readDigits() (uint64, bool) {
+	start := r.pos
+	var v uint64
+	overflow := false
+	for r.pos < len(r.data) && r.data[r.pos] >= '0' && r.data[r.pos] <= '9' {
+		d := uint64(r.data[r.pos] - '0')
+		if v > (1<<64-1-d)/10 {
+			overflow = true
+		}
+		v = v*10 + d
+		r.pos++
+	}
+	if r.pos == start {
+		r.fail("expected number")
+		return 0, false
+	}
+	if r.pos < len(r.data) {
+		switch r.data[r.pos] {
+		case '.', 'e', 'E':
+			r.fail("expected integer")
+			return 0, false
+		}
+	}
+	if overflow {
+		r.fail("number out of range")
+		return 0, false
+	}
+	return v, true
+}
+
+func intSize(bits int) int {
+	if bits == 0 {
+		return strconv.IntSize
+	}
+	return bits
+}
+
+// Int reads a signed integer fitting in bits, 0 for the size of int.
+func (r *JSONReader) Int(bits int) int64 {
+	neg := r.peek() == '-'
+	if neg {
+		r.pos++
+	}
+	v, ok := r.readDigits()
+	if !ok {
+		return 0
+	}
+	limit := uint64(1) << (intSize(bits) - 1)
+	if (!neg && v >= limit) || (neg && v > limit) {
+		r.fail("number out of range")
+		return 0
+	}
+	if neg {
+		return -int64(v)
+	}
+	return int64(v)
+}
+
+// Uint reads an unsigned integer fitting in bits, 0 for the size of uint.
+func (r *JSONReader) Uint(bits int) uint64 {
+	r.skipSpace()
+	v, ok := r.readDigits()
+	if !ok {
+		return 0
+	}
+	if n := intSize(bits); n < 64 && v >= 1<<n {
+		r.fail("number out of range")
+		return 0
+	}
+	return v
+}
+
+// Skip consumes a value of any type.
+func (r *JSONReader) Skip() {
+	r.skip(0)
+}
+
+func (r *JSONReader) skip(depth int) {
+	if depth > MaxDepth {
+		r.fail("exceeded max depth")
+		return
+	}
+
+	c := r.peek()
+	switch {
+	case c == '"':
+		r.readString()
+	case c == '{' || c == '[':
+		end := byte('}')
+		if c == '[' {
+			end = ']'
+		}
+		r.pos++
+		if r.peek() == end {
+			r.pos++
+			return
+		}
+		for r.err == nil {
+			if c == '{' {
+				r.readString()
+				if r.peek() != ':' {
+					r.fail("expected :")
+					return
+				}
+				r.pos++
+			}
+			r.skip(depth + 1)
+			switch r.peek() {
+			case ',':
+				r.pos++
+			case end:
+				r.pos++
+				return
+			default:
+				r.fail("expected , or " + string(end))
+			}
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := r.pos
+		for r.pos < len(r.data) && isNumberChar(r.data[r.pos]) {
+			r.pos++
+		}
+		if _, err := strconv.ParseFloat(string(r.data[start:r.pos]), 64); err != nil {
+			r.fail("invalid number")
+		}
+	case r.literal("true"), r.literal("false"), r.literal("null"):
+	default:
+		r.fail("invalid value")
+	}
+}
+
+func isNumberChar(c byte) bool {
+	return c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E' || (c >= '0' && c <= '9')
+}
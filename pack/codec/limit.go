@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"errors"
+	"strconv"
+)
+
+// DefaultMaxSize is the input limit of decoders that have no limit set.
+const DefaultMaxSize = 1 << 20
+
+// DefaultMaxDecompressedSize is the limit of decompressed input of decoders
+// that have no limit set.
+const DefaultMaxDecompressedSize = 4 * DefaultMaxSize
+
+// ErrSizeLimit matches every *SizeLimitError with errors.Is.
+var ErrSizeLimit = errors.New("size limit exceeded")
+
+// SizeLimitError is returned by decoders when the input, or what it expands
+// to, is larger than the limit.
+type SizeLimitError struct {
+	Size  int // may be Limit+1 when the input is not read to the end
+	Limit int
+}
+
+func (e *SizeLimitError) Error() string {
+	return "size " + strconv.Itoa(e.Size) + " exceeds limit " + strconv.Itoa(e.Limit)
+}
+
+func (e *SizeLimitError) Is(target error) bool { return target == ErrSizeLimit }
+
+// CheckSize returns a *SizeLimitError if size exceeds limit. A zero limit
+// means DefaultMaxSize, a negative one means no limit.
+func CheckSize(size, limit int) error {
+	if limit == 0 {
+		limit = DefaultMaxSize
+	}
+	if limit > 0 && size > limit {
+		return &SizeLimitError{Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// Limits bounds the input of decoders, so a forged header or a gzip bomb
+// can not make them allocate without limit. Zero fields take the defaults,
+// DefaultMaxSize and DefaultMaxDecompressedSize, negative ones disable the
+// limit.
+type Limits struct {
+	MaxFrameSize        int // size of an encoded value
+	MaxDecompressedSize int // size of a value after decompression
+}
+
+// CheckFrame checks the size of an encoded value.
+func (l Limits) CheckFrame(n int) error {
+	return CheckSize(n, l.MaxFrameSize)
+}
+
+// CheckDecompressed checks the size of a decompressed value.
+func (l Limits) CheckDecompressed(n int) error {
+	return CheckSize(n, l.DecompressedLimit())
+}
+
+// DecompressedLimit returns the limit of decompressed values, negative when
+// there is none.
+func (l Limits) DecompressedLimit() int {
+	if l.MaxDecompressedSize == 0 {
+		return DefaultMaxDecompressedSize
+	}
+	return l.MaxDecompressedSize
+}
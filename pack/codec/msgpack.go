@@ -0,0 +1,551 @@
+package codec
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Format codes, see https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt4  = 0xd6
+	mpFixExt8  = 0xd7
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+
+	mpTimeExt = -1
+)
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func AppendMsgpackNil(b []byte) []byte { return append(b, mpNil) }
+
+func AppendMsgpackMapLen(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, mpMap16, byte(n>>8), byte(n))
+	}
+	return append(b, mpMap32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func AppendMsgpackArrayLen(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, mpArray16, byte(n>>8), byte(n))
+	}
+	return append(b, mpArray32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendMsgpackLen(b []byte, n int, fix byte, c8, c16, c32 byte) []byte {
+	switch {
+	case fix != 0 && n < 32:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && c8 != 0:
+		return append(b, c8, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, c16, byte(n>>8), byte(n))
+	}
+	return append(b, c32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func AppendMsgpackString(b []byte, s string) []byte {
+	b = appendMsgpackLen(b, len(s), 0xa0, mpStr8, mpStr16, mpStr32)
+	return append(b, s...)
+}
+
+// AppendMsgpackBytes encodes v as bin, nil as nil.
+func AppendMsgpackBytes(b []byte, v []byte) []byte {
+	if v == nil {
+		return append(b, mpNil)
+	}
+	b = appendMsgpackLen(b, len(v), 0, mpBin8, mpBin16, mpBin32)
+	return append(b, v...)
+}
+
+func AppendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, mpTrue)
+	}
+	return append(b, mpFalse)
+}
+
+// AppendMsgpackUint uses the shortest encoding.
+func AppendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, mpUint8, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, mpUint16, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return append(b, mpUint32, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	b = append(b, mpUint64)
+	return appendUint64(b, v)
+}
+
+// AppendMsgpackInt uses the shortest encoding.
+func AppendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return AppendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, mpInt8, byte(v))
+	case v >= math.MinInt16:
+		return append(b, mpInt16, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		return append(b, mpInt32, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	b = append(b, mpInt64)
+	return appendUint64(b, uint64(v))
+}
+
+// AppendMsgpackUintN uses the fixed size of a bits wide integer, as
+// github.com/vmihailenco/msgpack does for typed integers. bits 0 is uint,
+// encoded as uint64.
+func AppendMsgpackUintN(b []byte, v uint64, bits int) []byte {
+	switch bits {
+	case 8:
+		return append(b, mpUint8, byte(v))
+	case 16:
+		return append(b, mpUint16, byte(v>>8), byte(v))
+	case 32:
+		return appendUint32(append(b, mpUint32), uint32(v))
+	}
+	return appendUint64(append(b, mpUint64), v)
+}
+
+// AppendMsgpackIntN is AppendMsgpackUintN for signed integers.
+func AppendMsgpackIntN(b []byte, v int64, bits int) []byte {
+	switch bits {
+	case 8:
+		return append(b, mpInt8, byte(v))
+	case 16:
+		return append(b, mpInt16, byte(v>>8), byte(v))
+	case 32:
+		return appendUint32(append(b, mpInt32), uint32(v))
+	}
+	return appendUint64(append(b, mpInt64), uint64(v))
+}
+
+// AppendMsgpackTime encodes t as the timestamp extension (type -1), the
+// same way github.com/vmihailenco/msgpack does.
+func AppendMsgpackTime(b []byte, t time.Time) []byte {
+	secs := uint64(t.Unix())
+	if secs>>34 == 0 {
+		data := uint64(t.Nanosecond())<<34 | secs
+		if data&0xffffffff00000000 == 0 {
+			b = append(b, mpFixExt4, 0xff)
+			return appendUint32(b, uint32(data))
+		}
+		b = append(b, mpFixExt8, 0xff)
+		return appendUint64(b, data)
+	}
+	b = append(b, mpExt8, 12, 0xff)
+	b = appendUint32(b, uint32(t.Nanosecond()))
+	return appendUint64(b, secs)
+}
+
+// MsgpackReader reads msgpack values one by one, the first error sticks and
+// is returned by End.
+type MsgpackReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *MsgpackReader) Reset(data []byte) {
+	*r = MsgpackReader{data: data}
+}
+
+func (r *MsgpackReader) Err() error { return r.err }
+
+func (r *MsgpackReader) fail(msg string) {
+	if r.err == nil {
+		r.err = &SyntaxError{Offset: r.pos, Msg: msg}
+	}
+}
+
+// End checks that the whole input was consumed.
+func (r *MsgpackReader) End() error {
+	if r.err == nil && r.pos != len(r.data) {
+		r.fail("unexpected data after value")
+	}
+	return r.err
+}
+
+func (r *MsgpackReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data)-r.pos < n {
+		r.fail("unexpected end of data")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *MsgpackReader) code() (byte, bool) {
+	b := r.next(1)
+	if b == nil {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func (r *MsgpackReader) uintN(n int) uint64 {
+	b := r.next(n)
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b))
+	case 8:
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// Nil consumes a nil value.
+func (r *MsgpackReader) Nil() bool {
+	if r.err == nil && r.pos < len(r.data) && r.data[r.pos] == mpNil {
+		r.pos++
+		return true
+	}
+	return false
+}
+
+// MapLen reads a map header, nil is an empty map.
+func (r *MsgpackReader) MapLen() int {
+	c, ok := r.code()
+	if !ok {
+		return 0
+	}
+	switch {
+	case c == mpNil:
+		return 0
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f)
+	case c == mpMap16:
+		return r.checkLen(r.uintN(2), 2)
+	case c == mpMap32:
+		return r.checkLen(r.uintN(4), 2)
+	}
+	r.fail("expected map")
+	return 0
+}
+
+// ArrayLen reads an array header, nil is an empty array.
+func (r *MsgpackReader) ArrayLen() int {
+	c, ok := r.code()
+	if !ok {
+		return 0
+	}
+	switch {
+	case c == mpNil:
+		return 0
+	case c&0xf0 == 0x90:
+		return int(c & 0x0f)
+	case c == mpArray16:
+		return r.checkLen(r.uintN(2), 1)
+	case c == mpArray32:
+		return r.checkLen(r.uintN(4), 1)
+	}
+	r.fail("expected array")
+	return 0
+}
+
+// checkLen bounds a length by the remaining data, each element taking at
+// least size bytes, so corrupted headers do not trigger huge loops.
+func (r *MsgpackReader) checkLen(n uint64, size int) int {
+	if r.err != nil {
+		return 0
+	}
+	if n > uint64(len(r.data)-r.pos)/uint64(size) {
+		r.fail("length exceeds data")
+		return 0
+	}
+	return int(n)
+}
+
+// raw reads a str or bin value, returning a slice of the input.
+func (r *MsgpackReader) raw() ([]byte, bool) {
+	c, ok := r.code()
+	if !ok {
+		return nil, false
+	}
+	var n uint64
+	switch {
+	case c == mpNil:
+		return nil, true
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == mpStr8 || c == mpBin8:
+		n = r.uintN(1)
+	case c == mpStr16 || c == mpBin16:
+		n = r.uintN(2)
+	case c == mpStr32 || c == mpBin32:
+		n = r.uintN(4)
+	default:
+		r.fail("expected string or bin")
+		return nil, false
+	}
+	b := r.next(r.checkLen(n, 1))
+	return b, b != nil
+}
+
+// Key reads a map key, valid until the input changes.
+func (r *MsgpackReader) Key() []byte {
+	b, _ := r.raw()
+	return b
+}
+
+func (r *MsgpackReader) String() string {
+	b, _ := r.raw()
+	return string(b)
+}
+
+// Bytes copies a bin or str value into a new slice, nil stays nil.
+func (r *MsgpackReader) Bytes() []byte {
+	b, ok := r.raw()
+	if !ok || b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+func (r *MsgpackReader) Bool() bool {
+	c, _ := r.code()
+	switch c {
+	case mpTrue:
+		return true
+	case mpFalse, mpNil:
+		return false
+	}
+	r.fail("expected bool")
+	return false
+}
+
+// number reads any integer, reporting whether it is negative.
+func (r *MsgpackReader) number() (uint64, bool) {
+	c, ok := r.code()
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case c <= 0x7f:
+		return uint64(c), false
+	case c >= 0xe0:
+		return uint64(int64(int8(c))), true
+	case c == mpNil:
+		return 0, false
+	case c == mpUint8:
+		return r.uintN(1), false
+	case c == mpUint16:
+		return r.uintN(2), false
+	case c == mpUint32:
+		return r.uintN(4), false
+	case c == mpUint64:
+		return r.uintN(8), false
+	case c == mpInt8:
+		v := int64(int8(r.uintN(1)))
+		return uint64(v), v < 0
+	case c == mpInt16:
+		v := int64(int16(r.uintN(2)))
+		return uint64(v), v < 0
+	case c == mpInt32:
+		v := int64(int32(r.uintN(4)))
+		return uint64(v), v < 0
+	case c == mpInt64:
+		v := int64(r.uintN(8))
+		return uint64(v), v < 0
+	}
+	r.fail("expected integer")
+	return 0, false
+}
+
+// Int reads a signed integer fitting in bits, 0 for the size of int.
+func (r *MsgpackReader) Int(bits int) int64 {
+	u, neg := r.number()
+	n := intSize(bits)
+	if !neg && u >= 1<<(n-1) {
+		r.fail("number out of range")
+		return 0
+	}
+	v := int64(u)
+	if neg && n < 64 && v < -1<<(n-1) {
+		r.fail("number out of range")
+		return 0
+	}
+	return v
+}
+
+// Uint reads an unsigned integer fitting in bits, 0 for the size of uint.
+func (r *MsgpackReader) Uint(bits int) uint64 {
+	v, neg := r.number()
+	if n := intSize(bits); neg || (n < 64 && v >= 1<<n) {
+		r.fail("number out of range")
+		return 0
+	}
+	return v
+}
+
+// Time reads the timestamp extension, nil is the zero time.
+func (r *MsgpackReader) Time() time.Time {
+	c, ok := r.code()
+	if !ok {
+		return time.Time{}
+	}
+
+	var n int
+	switch c {
+	case mpNil:
+		return time.Time{}.UTC()
+	case mpFixExt4:
+		n = 4
+	case mpFixExt8:
+		n = 8
+	case mpExt8:
+		n = int(r.uintN(1))
+	default:
+		r.fail("expected time")
+		return time.Time{}
+	}
+	typ := r.next(1)
+	b := r.next(n)
+	if b == nil {
+		return time.Time{}
+	}
+	if int8(typ[0]) != mpTimeExt {
+		r.fail("unexpected extension type " + strconv.Itoa(int(int8(typ[0]))))
+		return time.Time{}
+	}
+
+	var t time.Time
+	switch n {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(b)), 0)
+	case 8:
+		data := binary.BigEndian.Uint64(b)
+		t = time.Unix(int64(data&0x3ffffffff), int64(data>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b)))
+	default:
+		r.fail("invalid time length")
+		return time.Time{}
+	}
+	if t.IsZero() {
+		return t.UTC()
+	}
+	return t
+}
+
+// Skip consumes a value of any type.
+func (r *MsgpackReader) Skip() {
+	r.skip(0)
+}
+
+func (r *MsgpackReader) skip(depth int) {
+	if depth > MaxDepth {
+		r.fail("exceeded max depth")
+		return
+	}
+	c, ok := r.code()
+	if !ok {
+		return
+	}
+
+	var n uint64 // bytes to skip
+	var elems uint64
+	switch {
+	case c <= 0x7f || c >= 0xe0, c == mpNil, c == mpFalse, c == mpTrue:
+	case c&0xf0 == 0x80:
+		elems = uint64(c&0x0f) * 2
+	case c&0xf0 == 0x90:
+		elems = uint64(c & 0x0f)
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == mpStr8 || c == mpBin8:
+		n = r.uintN(1)
+	case c == mpStr16 || c == mpBin16:
+		n = r.uintN(2)
+	case c == mpStr32 || c == mpBin32:
+		n = r.uintN(4)
+	case c == mpExt8:
+		n = r.uintN(1) + 1
+	case c == mpExt16:
+		n = r.uintN(2) + 1
+	case c == mpExt32:
+		n = r.uintN(4) + 1
+	case c >= mpFixExt1 && c <= mpFixExt16:
+		n = 1<<(c-mpFixExt1) + 1
+	case c == mpUint8 || c == mpInt8:
+		n = 1
+	case c == mpUint16 || c == mpInt16:
+		n = 2
+	case c == mpUint32 || c == mpInt32 || c == mpFloat32:
+		n = 4
+	case c == mpUint64 || c == mpInt64 || c == mpFloat64:
+		n = 8
+	case c == mpArray16:
+		elems = r.uintN(2)
+	case c == mpArray32:
+		elems = r.uintN(4)
+	case c == mpMap16:
+		elems = r.uintN(2) * 2
+	case c == mpMap32:
+		elems = r.uintN(4) * 2
+	default:
+		r.fail("invalid code")
+		return
+	}
+
+	r.next(r.checkLen(n, 1))
+	for i := r.checkLen(elems, 1); i > 0 && r.err == nil; i-- {
+		r.skip(depth + 1)
+	}
+}
@@ -0,0 +1,121 @@
+package pack
+
+import (
+	"hash/maphash"
+	"time"
+)
+
+// DedupStats counts packets checked and duplicates dropped, per interface
+// the duplicate arrived on.
+type DedupStats struct {
+	Received  uint64
+	Dropped   uint64
+	ByIfIndex map[int]uint64
+}
+
+type dedupEntry struct {
+	key uint64
+	ts  time.Time
+}
+
+// Dedup detects packets whose Data was already seen within a time window,
+// such as the copies a SPAN port mirrors to several interfaces.
+// Windows are measured by packet Timestamp, not by wall clock.
+type Dedup struct {
+	window time.Duration
+	hash   maphash.Hash
+	seen   map[uint64]time.Time
+	queue  []dedupEntry
+	head   int
+	stats  DedupStats
+}
+
+func NewDedup(window time.Duration) *Dedup {
+	d := &Dedup{
+		window: window,
+		seen:   make(map[uint64]time.Time),
+		stats:  DedupStats{ByIfIndex: make(map[int]uint64)},
+	}
+	d.hash.SetSeed(maphash.MakeSeed())
+	return d
+}
+
+func (d *Dedup) key(data []byte) uint64 {
+	d.hash.Reset()
+	d.hash.Write(data)
+	return d.hash.Sum64()
+}
+
+// expire forgets the entries older than the window before ts.
+func (d *Dedup) expire(ts time.Time) {
+	for d.head < len(d.queue) {
+		e := d.queue[d.head]
+		if ts.Sub(e.ts) <= d.window {
+			break
+		}
+		if last, ok := d.seen[e.key]; ok && !last.After(e.ts) {
+			delete(d.seen, e.key)
+		}
+		d.head++
+	}
+	if d.head > 1024 && d.head > len(d.queue)/2 {
+		n := copy(d.queue, d.queue[d.head:])
+		d.queue = d.queue[:n]
+		d.head = 0
+	}
+}
+
+// IsDuplicate reports whether p duplicates a packet seen within the window,
+// and remembers p otherwise.
+func (d *Dedup) IsDuplicate(p *CapturePacket) bool {
+	d.stats.Received++
+	d.expire(p.Timestamp)
+
+	key := d.key(p.Data)
+	if ts, ok := d.seen[key]; ok {
+		delta := p.Timestamp.Sub(ts)
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta <= d.window {
+			d.stats.Dropped++
+			d.stats.ByIfIndex[p.InterfaceIndex]++
+			return true
+		}
+	}
+
+	d.seen[key] = p.Timestamp
+	d.queue = append(d.queue, dedupEntry{key: key, ts: p.Timestamp})
+	return false
+}
+
+func (d *Dedup) Stats() DedupStats {
+	s := d.stats
+	s.ByIfIndex = make(map[int]uint64, len(d.stats.ByIfIndex))
+	for k, v := range d.stats.ByIfIndex {
+		s.ByIfIndex[k] = v
+	}
+	return s
+}
+
+// DedupReader drops duplicated packets read from r.
+type DedupReader struct {
+	*Dedup
+	r PacketReader
+}
+
+func NewDedupReader(r PacketReader, window time.Duration) *DedupReader {
+	return &DedupReader{Dedup: NewDedup(window), r: r}
+}
+
+func (dr *DedupReader) ReadPacket(p *CapturePacket) error {
+	for {
+		err := dr.r.ReadPacket(p)
+		if err != nil {
+			return err
+		}
+		if !dr.IsDuplicate(p) {
+			return nil
+		}
+	}
+}
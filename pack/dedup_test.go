@@ -0,0 +1,36 @@
+package pack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupReader(t *testing.T) {
+	ts := time.UnixMicro(time.Now().UnixMicro())
+	at := func(iface int, us int, data string) CapturePacket {
+		return CapturePacket{
+			CaptureInfo: CaptureInfo{Timestamp: ts.Add(time.Duration(us) * time.Microsecond), InterfaceIndex: iface},
+			Data:        []byte(data),
+		}
+	}
+
+	in := []CapturePacket{
+		at(1, 0, "a"),
+		at(2, 3, "a"), // mirrored copy
+		at(1, 5, "b"),
+		at(2, 4, "b"),   // mirrored copy arriving slightly earlier
+		at(1, 200, "a"), // same payload out of the window
+		at(2, 205, "a"),
+	}
+	dr := NewDedupReader(&sliceReader{packets: in}, 10*time.Microsecond)
+
+	out := readAllPackets(t, dr)
+	assert.Equal(t, []CapturePacket{in[0], in[2], in[4]}, out, "invalid dedup result")
+
+	stats := dr.Stats()
+	assert.Equal(t, uint64(6), stats.Received, "invalid received")
+	assert.Equal(t, uint64(3), stats.Dropped, "invalid dropped")
+	assert.Equal(t, map[int]uint64{2: 3}, stats.ByIfIndex, "invalid dropped by interface")
+}
@@ -0,0 +1,162 @@
+package pack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzBinaryPackDecode(f *testing.F) {
+	for _, p := range packets {
+		f.Add(BinaryPack.Encode(&p))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p CapturePacket
+		if BinaryPack.Decode(data, &p) != nil {
+			return
+		}
+		var pd CapturePacket
+		assert.NoError(t, BinaryPack.Decode(BinaryPack.Encode(&p), &pd), "decode failed")
+		assertPacketEqual(t, &p, &pd)
+
+		putfn, err := BinaryPack.DecodeWithPool(data, &pd)
+		assert.NoError(t, err, "decode with pool failed")
+		assertPacketEqual(t, &p, &pd)
+		putfn()
+	})
+}
+
+func FuzzBinaryPackReader(f *testing.F) {
+	buf := bytes.NewBuffer(nil)
+	for _, p := range packets {
+		BinaryPack.EncodeTo(&p, buf)
+	}
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Writing what was read and reading it again must give the same bytes.
+		out := copyBinaryPack(bytes.NewReader(data))
+		assert.Equal(t, out, copyBinaryPack(bytes.NewReader(out)), "round trip not stable")
+	})
+}
+
+func copyBinaryPack(r *bytes.Reader) []byte {
+	br := NewBinaryPackReader(r)
+	buf := bytes.NewBuffer(nil)
+	w := NewBinaryPackWriter(buf)
+	var p CapturePacket
+	for br.ReadPacket(&p) == nil {
+		w.WritePacket(&p)
+	}
+	return buf.Bytes()
+}
+
+func FuzzJsonCompressPackDecode(f *testing.F) {
+	for _, p := range packets {
+		data, err := JsonCompressPack{}.Encode(&p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p CapturePacket
+		if (JsonCompressPack{}).Decode(data, &p) != nil {
+			return
+		}
+		data, err := JsonCompressPack{}.Encode(&p)
+		if err != nil {
+			return
+		}
+		var pd CapturePacket
+		assert.NoError(t, JsonCompressPack{}.Decode(data, &pd), "decode failed")
+		assertPacketEqual(t, &p, &pd)
+	})
+}
+
+func FuzzPcapReader(f *testing.F) {
+	buf := bytes.NewBuffer(nil)
+	w := NewPcapWriter(buf, 65535, LinkTypeEthernet)
+	for _, p := range packets {
+		w.WritePacket(&p)
+	}
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out := copyPcap(data)
+		assert.Equal(t, out, copyPcap(out), "round trip not stable")
+	})
+}
+
+func copyPcap(data []byte) []byte {
+	r, err := NewPcapReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	buf := bytes.NewBuffer(nil)
+	w := NewPcapWriter(buf, 65535, r.LinkType())
+	var p CapturePacket
+	for r.ReadPacket(&p) == nil {
+		w.WritePacket(&p)
+	}
+	return buf.Bytes()
+}
+
+func FuzzCapturePacketJSONDecode(f *testing.F) {
+	for _, p := range packets {
+		f.Add(CapturePacketJSON.Encode(&p))
+	}
+	f.Add([]byte(`{"ts":null,"id":1,"x":[{"a":"😀"}]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p CapturePacket
+		if CapturePacketJSON.Decode(data, &p) != nil {
+			return
+		}
+		var pd CapturePacket
+		assert.NoError(t, CapturePacketJSON.Decode(CapturePacketJSON.Encode(&p), &pd), "decode failed")
+		assertPacketEqual(t, &p, &pd)
+	})
+}
+
+func FuzzCapturePacketMsgpackDecode(f *testing.F) {
+	for _, p := range packets {
+		f.Add(CapturePacketMsgpack.Encode(&p))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p CapturePacket
+		if CapturePacketMsgpack.Decode(data, &p) != nil {
+			return
+		}
+		var pd CapturePacket
+		assert.NoError(t, CapturePacketMsgpack.Decode(CapturePacketMsgpack.Encode(&p), &pd), "decode failed")
+		assertPacketEqual(t, &p, &pd)
+	})
+}
+
+func FuzzCapturePacketJSONDecodeSlice(f *testing.F) {
+	// Without the 16KiB packet, the fuzzer stalls on larger seeds.
+	f.Add(CapturePacketJSON.EncodeSlice(packets[:2]))
+	f.Add([]byte(`[null,{"id":1},{}]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ps []CapturePacket
+		if CapturePacketJSON.DecodeSlice(data, &ps) != nil {
+			return
+		}
+		var pd []CapturePacket
+		assert.NoError(t, CapturePacketJSON.DecodeSlice(CapturePacketJSON.EncodeSlice(ps), &pd), "decode failed")
+		assertSliceEqual(t, ps, pd)
+	})
+}
+
+func FuzzCapturePacketMsgpackDecodeSlice(f *testing.F) {
+	// Without the 16KiB packet, the fuzzer stalls on larger seeds.
+	f.Add(CapturePacketMsgpack.EncodeSlice(packets[:2]))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ps []CapturePacket
+		if CapturePacketMsgpack.DecodeSlice(data, &ps) != nil {
+			return
+		}
+		var pd []CapturePacket
+		assert.NoError(t, CapturePacketMsgpack.DecodeSlice(CapturePacketMsgpack.EncodeSlice(ps), &pd), "decode failed")
+		assertSliceEqual(t, ps, pd)
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"io"
 	"sync"
 	"time"
+
+	"benchmark/pack/codec"
 )
 
 // from github.com/google/gopacket
@@ -24,6 +26,8 @@ type CaptureInfo struct {
 	InterfaceIndex int `json:"iface_idx" msgpack:"iface_idx"`
 }
 
+//go:generate go run benchmark/cmd/codecgen -type CapturePacket
+
 type CapturePacket struct {
 	CaptureInfo
 	Id   uint32 `json:"id" msgpack:"id"`
@@ -34,6 +38,16 @@ const (
 	CapturePacketMetaLen = 22
 )
 
+// Limits bounds the input of decoders, zero Limits take the defaults. The
+// codecs are values, so each decoder can have its own.
+type Limits = codec.Limits
+
+// SizeLimitError is returned when Limits are exceeded, it matches
+// ErrSizeLimit with errors.Is.
+type SizeLimitError = codec.SizeLimitError
+
+var ErrSizeLimit = codec.ErrSizeLimit
+
 // Reduce packet meta memory allocation.
 var (
 	metaBufPool   = sync.Pool{New: func() interface{} { return new([CapturePacketMetaLen]byte) }}
@@ -69,17 +83,21 @@ func acquirePacketBuf(n int) ([]byte, func()) {
 }
 
 // Assuming these int values does not exceed 65535，the size can be reduced by a few bytes.
-type binaryPack struct{}
+type BinaryPackCodec struct {
+	Limits
+}
 
-var BinaryPack binaryPack
+// BinaryPack has the default Limits, decoders with other ones are
+// BinaryPackCodec values of their own.
+var BinaryPack BinaryPackCodec
 
-func (bp binaryPack) Encode(p *CapturePacket) []byte {
+func (bp BinaryPackCodec) Encode(p *CapturePacket) []byte {
 	buf := bytes.NewBuffer(make([]byte, 0, CapturePacketMetaLen+len(p.Data)))
 	bp.EncodeTo(p, buf)
 	return buf.Bytes()
 }
 
-func (bp binaryPack) EncodeWithPool(p *CapturePacket) ([]byte, func()) {
+func (bp BinaryPackCodec) EncodeWithPool(p *CapturePacket) ([]byte, func()) {
 	b, putfn := acquirePacketBuf(CapturePacketMetaLen + len(p.Data))
 	buf := bytes.NewBuffer(b)
 	bp.EncodeTo(p, buf)
@@ -88,7 +106,7 @@ func (bp binaryPack) EncodeWithPool(p *CapturePacket) ([]byte, func()) {
 
 // Write encoded data directly without allocating memory.
 // So at the calling point, this writer can be reused.
-func (binaryPack) EncodeTo(p *CapturePacket, w io.Writer) (int, error) {
+func (BinaryPackCodec) EncodeTo(p *CapturePacket, w io.Writer) (int, error) {
 	buf := metaBufPool.Get().(*[CapturePacketMetaLen]byte)
 	defer metaBufPool.Put(buf)
 
@@ -106,8 +124,8 @@ func (binaryPack) EncodeTo(p *CapturePacket, w io.Writer) (int, error) {
 	return nm + nd, err
 }
 
-func (bp binaryPack) Decode(data []byte, p *CapturePacket) error {
-	err := bp.DecodeMeta(data, p)
+func (bp BinaryPackCodec) Decode(data []byte, p *CapturePacket) error {
+	err := bp.decodeFrame(data, p)
 	if err != nil {
 		return err
 	}
@@ -116,19 +134,42 @@ func (bp binaryPack) Decode(data []byte, p *CapturePacket) error {
 	return nil
 }
 
-func (bp binaryPack) DecodeWithPool(data []byte, p *CapturePacket) (func(), error) {
-	err := bp.DecodeMeta(data, p)
+func (bp BinaryPackCodec) DecodeWithPool(data []byte, p *CapturePacket) (func(), error) {
+	err := bp.decodeFrame(data, p)
 	if err != nil {
 		return nil, err
 	}
 
-	b, putfn := acquirePacketBuf(len(data[CapturePacketMetaLen:]))
-	p.Data = b[:len(data[CapturePacketMetaLen:])]
+	n := len(data) - CapturePacketMetaLen
+	b, putfn := acquirePacketBuf(n)
+	if cap(b) < n {
+		putfn()
+		b, putfn = make([]byte, n), func() {}
+	}
+	p.Data = b[:n]
 	copy(p.Data, data[CapturePacketMetaLen:])
 	return putfn, nil
 }
 
-func (binaryPack) DecodeMeta(data []byte, p *CapturePacket) error {
+// decodeFrame decodes the meta of a whole frame, and checks it against the
+// frame size. CaptureLength is stored in 16 bits, so 64KiB of data is written
+// as 0: they are compared in 16 bits, the size is bounded by Limits.
+func (bp BinaryPackCodec) decodeFrame(data []byte, p *CapturePacket) error {
+	err := bp.CheckFrame(len(data))
+	if err != nil {
+		return err
+	}
+	err = bp.DecodeMeta(data, p)
+	if err != nil {
+		return err
+	}
+	if uint16(p.CaptureLength) != uint16(len(data)-CapturePacketMetaLen) {
+		return errors.New("invalid packet capture length")
+	}
+	return nil
+}
+
+func (BinaryPackCodec) DecodeMeta(data []byte, p *CapturePacket) error {
 	if len(data) < CapturePacketMetaLen {
 		return errors.New("invalid packet meta data")
 	}
@@ -141,7 +182,9 @@ func (binaryPack) DecodeMeta(data []byte, p *CapturePacket) error {
 	return nil
 }
 
-type JsonCompressPack struct{}
+type JsonCompressPack struct {
+	Limits
+}
 
 func (jcp JsonCompressPack) Encode(p *CapturePacket) ([]byte, error) {
 	data, err := json.Marshal(p)
@@ -164,6 +207,11 @@ func (jcp JsonCompressPack) Encode(p *CapturePacket) ([]byte, error) {
 }
 
 func (jcp JsonCompressPack) Decode(data []byte, p *CapturePacket) error {
+	err := jcp.CheckFrame(len(data))
+	if err != nil {
+		return err
+	}
+
 	b := bytes.NewBuffer(data)
 	gr, err := gzip.NewReader(b)
 	if err != nil {
@@ -171,7 +219,17 @@ func (jcp JsonCompressPack) Decode(data []byte, p *CapturePacket) error {
 	}
 	defer gr.Close()
 
-	decompressedData, err := io.ReadAll(gr)
+	// Read one byte more than the limit to tell if it is exceeded.
+	limit := jcp.DecompressedLimit()
+	r := io.Reader(gr)
+	if limit > 0 {
+		r = io.LimitReader(gr, int64(limit)+1)
+	}
+	decompressedData, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	err = jcp.CheckDecompressed(len(decompressedData))
 	if err != nil {
 		return err
 	}
@@ -2,7 +2,9 @@ package pack
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"strconv"
 	"testing"
@@ -96,6 +98,21 @@ func TestBinaryPack(t *testing.T) {
 	}
 }
 
+func TestBinaryPack64KiB(t *testing.T) {
+	p := CapturePacket{Data: makeRandomN(65536)}
+	p.CaptureLength = len(p.Data)
+	data := BinaryPack.Encode(&p)
+
+	var pd CapturePacket
+	assert.NoError(t, BinaryPack.Decode(data, &pd), "decode failed")
+	assert.Equal(t, p.Data, pd.Data, "invalid data")
+
+	putfn, err := BinaryPack.DecodeWithPool(data, &pd)
+	assert.NoError(t, err, "decode with pool failed")
+	assert.Equal(t, p.Data, pd.Data, "invalid data")
+	putfn()
+}
+
 func BenchmarkBinaryPack(b *testing.B) {
 	b.ReportAllocs()
 
@@ -316,3 +333,41 @@ func BenchmarkJsonCompressPack(b *testing.B) {
 		})
 	}
 }
+
+func TestLimits(t *testing.T) {
+	bp := BinaryPackCodec{Limits{MaxFrameSize: 100}}
+	data := BinaryPack.Encode(&middlePacket)
+	var p CapturePacket
+	err := bp.Decode(data, &p)
+	assert.True(t, errors.Is(err, ErrSizeLimit), "frame limit not applied")
+	var se *SizeLimitError
+	assert.True(t, errors.As(err, &se), "size limit error expected")
+	assert.Equal(t, len(data), se.Size, "invalid size")
+	assert.Equal(t, 100, se.Limit, "invalid limit")
+
+	_, err = bp.DecodeWithPool(data, &p)
+	assert.True(t, errors.Is(err, ErrSizeLimit), "frame limit not applied")
+
+	r := NewBinaryPackReader(bytes.NewReader(data))
+	r.MaxFrameSize = 100
+	assert.True(t, errors.Is(r.ReadPacket(&p), ErrSizeLimit), "frame limit not applied")
+
+	// Frames larger than the pool buffers must not panic.
+	big := make([]byte, CapturePacketMetaLen+70000)
+	_, err = BinaryPack.DecodeWithPool(big, &p)
+	assert.Error(t, err, "capture length does not match")
+
+	buf := bytes.NewBuffer(nil)
+	w := gzip.NewWriter(buf)
+	w.Write(make([]byte, 1<<20))
+	w.Close()
+	jcp := JsonCompressPack{Limits{MaxDecompressedSize: 1024}}
+	assert.True(t, errors.Is(jcp.Decode(buf.Bytes(), &p), ErrSizeLimit), "decompressed limit not applied")
+	jcp = JsonCompressPack{Limits{MaxFrameSize: 16}}
+	assert.True(t, errors.Is(jcp.Decode(buf.Bytes(), &p), ErrSizeLimit), "frame limit not applied")
+
+	dec := CapturePacketJSONCodec{Limits{MaxFrameSize: 16}}
+	assert.True(t, errors.Is(dec.Decode(CapturePacketJSON.Encode(&smallPacket), &p), ErrSizeLimit), "json limit not applied")
+	mdec := CapturePacketMsgpackCodec{Limits{MaxFrameSize: 16}}
+	assert.True(t, errors.Is(mdec.Decode(CapturePacketMsgpack.Encode(&smallPacket), &p), ErrSizeLimit), "msgpack limit not applied")
+}
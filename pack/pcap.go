@@ -0,0 +1,143 @@
+package pack
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+
+	pcapHeaderLen       = 24
+	pcapRecordHeaderLen = 16
+
+	LinkTypeEthernet = 1
+)
+
+// PcapWriter exports packets in the classic pcap file format with
+// microsecond timestamps. InterfaceIndex and Id are not kept.
+type PcapWriter struct {
+	w           io.Writer
+	snapLen     uint32
+	linkType    uint32
+	wroteHeader bool
+	hdr         [pcapRecordHeaderLen]byte
+}
+
+func NewPcapWriter(w io.Writer, snapLen int, linkType int) *PcapWriter {
+	return &PcapWriter{w: w, snapLen: uint32(snapLen), linkType: uint32(linkType)}
+}
+
+func (pw *PcapWriter) writeHeader() error {
+	var hdr [pcapHeaderLen]byte
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicMicro)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pw.snapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], pw.linkType)
+	_, err := pw.w.Write(hdr[:])
+	return err
+}
+
+func (pw *PcapWriter) WritePacket(p *CapturePacket) error {
+	if p.CaptureLength != len(p.Data) || p.Length < p.CaptureLength {
+		return errors.New("invalid packet capture length")
+	}
+	if !pw.wroteHeader {
+		err := pw.writeHeader()
+		if err != nil {
+			return err
+		}
+		pw.wroteHeader = true
+	}
+
+	us := p.Timestamp.UnixMicro()
+	binary.LittleEndian.PutUint32(pw.hdr[0:], uint32(us/1e6))
+	binary.LittleEndian.PutUint32(pw.hdr[4:], uint32(us%1e6))
+	binary.LittleEndian.PutUint32(pw.hdr[8:], uint32(p.CaptureLength))
+	binary.LittleEndian.PutUint32(pw.hdr[12:], uint32(p.Length))
+
+	_, err := pw.w.Write(pw.hdr[:])
+	if err != nil {
+		return err
+	}
+	_, err = pw.w.Write(p.Data)
+	return err
+}
+
+// PcapReader reads packets from a classic pcap file of either byte order
+// and timestamp resolution. Record lengths are checked against
+// Limits.MaxFrameSize.
+type PcapReader struct {
+	Limits
+	r        io.Reader
+	order    binary.ByteOrder
+	nano     bool
+	snapLen  uint32
+	linkType uint32
+	hdr      [pcapRecordHeaderLen]byte
+}
+
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	var hdr [pcapHeaderLen]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PcapReader{r: r}
+	switch magic := binary.LittleEndian.Uint32(hdr[:]); magic {
+	case pcapMagicMicro, pcapMagicNano:
+		pr.order = binary.LittleEndian
+		pr.nano = magic == pcapMagicNano
+	default:
+		switch binary.BigEndian.Uint32(hdr[:]) {
+		case pcapMagicMicro, pcapMagicNano:
+			pr.order = binary.BigEndian
+			pr.nano = binary.BigEndian.Uint32(hdr[:]) == pcapMagicNano
+		default:
+			return nil, errors.New("invalid pcap magic")
+		}
+	}
+	pr.snapLen = pr.order.Uint32(hdr[16:])
+	pr.linkType = pr.order.Uint32(hdr[20:])
+	return pr, nil
+}
+
+func (pr *PcapReader) LinkType() int { return int(pr.linkType) }
+
+func (pr *PcapReader) ReadPacket(p *CapturePacket) error {
+	_, err := io.ReadFull(pr.r, pr.hdr[:])
+	if err != nil {
+		return err
+	}
+
+	sec := int64(pr.order.Uint32(pr.hdr[0:]))
+	frac := int64(pr.order.Uint32(pr.hdr[4:]))
+	if !pr.nano {
+		frac *= 1e3
+	}
+	capLen := pr.order.Uint32(pr.hdr[8:])
+	if capLen > pr.snapLen && capLen > 0x40000 {
+		return errors.New("invalid pcap record length")
+	}
+	err = pr.CheckFrame(int(capLen))
+	if err != nil {
+		return err
+	}
+
+	p.Timestamp = time.Unix(sec, frac)
+	p.CaptureLength = int(capLen)
+	p.Length = int(pr.order.Uint32(pr.hdr[12:]))
+	p.InterfaceIndex = 0
+	p.Id = 0
+	p.Data = make([]byte, capLen)
+	_, err = io.ReadFull(pr.r, p.Data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
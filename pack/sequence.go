@@ -0,0 +1,329 @@
+package pack
+
+import (
+	"io"
+	"sort"
+)
+
+// SeqEvent classifies a packet by its Id against the ones seen before on
+// the same InterfaceIndex.
+type SeqEvent int
+
+const (
+	SeqInOrder    SeqEvent = iota // Id is the expected one
+	SeqGap                        // Id is ahead, the ids in between are missing
+	SeqDuplicate                  // Id was already seen
+	SeqOutOfOrder                 // Id was missing and arrived late
+	SeqStale                      // Id is too far behind to be classified
+)
+
+func (e SeqEvent) String() string {
+	switch e {
+	case SeqInOrder:
+		return "in_order"
+	case SeqGap:
+		return "gap"
+	case SeqDuplicate:
+		return "duplicate"
+	case SeqOutOfOrder:
+		return "out_of_order"
+	case SeqStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// SeqStats counts sequence events, Lost is the number of ids skipped by
+// gaps that have not (yet) arrived late.
+type SeqStats struct {
+	Received   uint64
+	Gaps       uint64
+	Lost       uint64
+	Duplicates uint64
+	OutOfOrder uint64
+	Stale      uint64
+}
+
+func (s *SeqStats) add(o SeqStats) {
+	s.Received += o.Received
+	s.Gaps += o.Gaps
+	s.Lost += o.Lost
+	s.Duplicates += o.Duplicates
+	s.OutOfOrder += o.OutOfOrder
+	s.Stale += o.Stale
+}
+
+type SeqConfig struct {
+	// IdBits is the width of the Id space, ids wrap around after 1<<IdBits.
+	// BinaryPack keeps only 16 bits of Id, the default is 32.
+	IdBits int
+	// History is the number of ids behind the newest one remembered to tell
+	// duplicates from late arrivals, rounded up to a power of two. Default 1024.
+	History int
+	// ReorderWindow is the max number of packets per interface held back to
+	// restore Id order, 0 disables reordering.
+	ReorderWindow int
+}
+
+// SeqTracker tracks packet ids per InterfaceIndex.
+type SeqTracker struct {
+	mask    uint32
+	history uint32
+	ifaces  map[int]*seqState
+}
+
+type seqState struct {
+	started bool
+	next    uint32 // next expected id
+	covered uint32 // ids tracked so far, up to history
+	seen    []uint64
+	stats   SeqStats
+}
+
+func NewSeqTracker(cfg SeqConfig) *SeqTracker {
+	mask := ^uint32(0)
+	if cfg.IdBits > 0 && cfg.IdBits < 32 {
+		mask = 1<<cfg.IdBits - 1
+	}
+	history := uint32(1024)
+	if cfg.History > 0 {
+		history = 64
+		for history < uint32(cfg.History) {
+			history <<= 1
+		}
+	}
+	if history > mask/2 {
+		history = (mask >> 1) + 1
+	}
+	return &SeqTracker{mask: mask, history: history, ifaces: make(map[int]*seqState)}
+}
+
+func (t *SeqTracker) state(iface int) *seqState {
+	st, ok := t.ifaces[iface]
+	if !ok {
+		st = &seqState{seen: make([]uint64, (t.history+63)/64)}
+		t.ifaces[iface] = st
+	}
+	return st
+}
+
+func (t *SeqTracker) bit(st *seqState, id uint32) (int, uint64) {
+	i := id & (t.history - 1)
+	return int(i / 64), 1 << (i % 64)
+}
+
+func (t *SeqTracker) mark(st *seqState, id uint32, seen bool) {
+	w, b := t.bit(st, id)
+	if seen {
+		st.seen[w] |= b
+	} else {
+		st.seen[w] &^= b
+	}
+}
+
+// Track classifies p and updates the stats of its interface.
+func (t *SeqTracker) Track(p *CapturePacket) SeqEvent {
+	st := t.state(p.InterfaceIndex)
+	id := p.Id & t.mask
+	st.stats.Received++
+
+	if !st.started {
+		st.started = true
+		st.next = (id + 1) & t.mask
+		st.covered = 1
+		t.mark(st, id, true)
+		return SeqInOrder
+	}
+
+	ahead := (id - st.next) & t.mask
+	if ahead <= t.mask/2 {
+		// Forget the skipped ids, their slots may hold older ones.
+		n := ahead
+		if n > t.history {
+			n = t.history
+		}
+		for i := uint32(0); i < n; i++ {
+			t.mark(st, (id-i-1)&t.mask, false)
+		}
+		t.mark(st, id, true)
+		st.next = (id + 1) & t.mask
+		st.covered += ahead + 1
+		if st.covered > t.history {
+			st.covered = t.history
+		}
+		if ahead == 0 {
+			return SeqInOrder
+		}
+		st.stats.Gaps++
+		st.stats.Lost += uint64(ahead)
+		return SeqGap
+	}
+
+	behind := (st.next - id) & t.mask
+	if behind > st.covered {
+		st.stats.Stale++
+		return SeqStale
+	}
+	w, b := t.bit(st, id)
+	if st.seen[w]&b != 0 {
+		st.stats.Duplicates++
+		return SeqDuplicate
+	}
+	st.seen[w] |= b
+	st.stats.OutOfOrder++
+	st.stats.Lost--
+	return SeqOutOfOrder
+}
+
+// Stats returns the stats of one interface.
+func (t *SeqTracker) Stats(iface int) SeqStats {
+	if st, ok := t.ifaces[iface]; ok {
+		return st.stats
+	}
+	return SeqStats{}
+}
+
+// Total returns the stats summed over all interfaces.
+func (t *SeqTracker) Total() SeqStats {
+	var s SeqStats
+	for _, st := range t.ifaces {
+		s.add(st.stats)
+	}
+	return s
+}
+
+// SeqReader tracks the ids of packets read from r, and restores their order
+// within SeqConfig.ReorderWindow before handing them out.
+//
+// A gap is given up when the window is full or r hits EOF, packets arriving
+// behind what has been handed out are passed through as they come. When
+// reordering, duplicates are dropped.
+type SeqReader struct {
+	r       PacketReader
+	tracker *SeqTracker
+	window  int
+	ifaces  map[int]*reorderState
+	ready   []CapturePacket
+	eof     bool
+}
+
+type reorderState struct {
+	started bool
+	next    uint32
+	pending map[uint32]CapturePacket
+}
+
+// Reordering keeps the packets read from r, so r must not reuse Data.
+func NewSeqReader(r PacketReader, cfg SeqConfig) *SeqReader {
+	return &SeqReader{
+		r:       r,
+		tracker: NewSeqTracker(cfg),
+		window:  cfg.ReorderWindow,
+		ifaces:  make(map[int]*reorderState),
+	}
+}
+
+func (sr *SeqReader) Tracker() *SeqTracker { return sr.tracker }
+
+func (sr *SeqReader) ReadPacket(p *CapturePacket) error {
+	for {
+		if len(sr.ready) > 0 {
+			*p = sr.ready[0]
+			sr.ready[0] = CapturePacket{}
+			sr.ready = sr.ready[1:]
+			return nil
+		}
+		if sr.eof {
+			return io.EOF
+		}
+
+		var in CapturePacket
+		err := sr.r.ReadPacket(&in)
+		if err == io.EOF {
+			sr.eof = true
+			sr.flush()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		ev := sr.tracker.Track(&in)
+		if sr.window <= 0 {
+			*p = in
+			return nil
+		}
+		if ev != SeqDuplicate {
+			sr.reorder(&in)
+		}
+	}
+}
+
+func (sr *SeqReader) reorder(p *CapturePacket) {
+	mask := sr.tracker.mask
+	id := p.Id & mask
+
+	rs, ok := sr.ifaces[p.InterfaceIndex]
+	if !ok {
+		rs = &reorderState{pending: make(map[uint32]CapturePacket)}
+		sr.ifaces[p.InterfaceIndex] = rs
+	}
+	if !rs.started {
+		rs.started = true
+		rs.next = id
+	}
+
+	if (id-rs.next)&mask > mask/2 {
+		sr.ready = append(sr.ready, *p)
+		return
+	}
+	rs.pending[id] = *p
+
+	sr.release(rs)
+	for len(rs.pending) > sr.window {
+		sr.skip(rs)
+		sr.release(rs)
+	}
+}
+
+func (sr *SeqReader) release(rs *reorderState) {
+	for {
+		p, ok := rs.pending[rs.next]
+		if !ok {
+			return
+		}
+		delete(rs.pending, rs.next)
+		sr.ready = append(sr.ready, p)
+		rs.next = (rs.next + 1) & sr.tracker.mask
+	}
+}
+
+// skip moves past a gap to the closest pending id.
+func (sr *SeqReader) skip(rs *reorderState) {
+	mask := sr.tracker.mask
+	first := true
+	var closest uint32
+	for id := range rs.pending {
+		d := (id - rs.next) & mask
+		if first || d < closest {
+			closest, first = d, false
+		}
+	}
+	rs.next = (rs.next + closest) & mask
+}
+
+func (sr *SeqReader) flush() {
+	ifaces := make([]int, 0, len(sr.ifaces))
+	for iface := range sr.ifaces {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Ints(ifaces)
+
+	for _, iface := range ifaces {
+		rs := sr.ifaces[iface]
+		for len(rs.pending) > 0 {
+			sr.skip(rs)
+			sr.release(rs)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package pack
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceReader struct{ packets []CapturePacket }
+
+func (sr *sliceReader) ReadPacket(p *CapturePacket) error {
+	if len(sr.packets) == 0 {
+		return io.EOF
+	}
+	*p = sr.packets[0]
+	sr.packets = sr.packets[1:]
+	return nil
+}
+
+func makeSeqPackets(iface int, ids ...uint32) []CapturePacket {
+	ps := make([]CapturePacket, len(ids))
+	for i, id := range ids {
+		ps[i] = CapturePacket{CaptureInfo: CaptureInfo{InterfaceIndex: iface}, Id: id}
+	}
+	return ps
+}
+
+func readAllPackets(t *testing.T, r PacketReader) []CapturePacket {
+	var ps []CapturePacket
+	for {
+		var p CapturePacket
+		err := r.ReadPacket(&p)
+		if err == io.EOF {
+			return ps
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps = append(ps, p)
+	}
+}
+
+func TestSeqTracker(t *testing.T) {
+	tracker := NewSeqTracker(SeqConfig{})
+
+	var events []SeqEvent
+	for _, p := range makeSeqPackets(1, 1, 2, 5, 3, 3, 6, 2) {
+		events = append(events, tracker.Track(&p))
+	}
+	assert.Equal(t, []SeqEvent{SeqInOrder, SeqInOrder, SeqGap, SeqOutOfOrder, SeqDuplicate, SeqInOrder, SeqDuplicate}, events, "invalid events")
+	assert.Equal(t, SeqStats{Received: 7, Gaps: 1, Lost: 1, Duplicates: 2, OutOfOrder: 1}, tracker.Stats(1), "invalid stats")
+
+	p := makeSeqPackets(2, 100)[0]
+	assert.Equal(t, SeqInOrder, tracker.Track(&p), "interfaces must be tracked apart")
+	assert.Equal(t, uint64(8), tracker.Total().Received, "invalid total")
+}
+
+func TestSeqTrackerWrap(t *testing.T) {
+	tracker := NewSeqTracker(SeqConfig{IdBits: 16, History: 64})
+
+	var events []SeqEvent
+	for _, p := range makeSeqPackets(0, 65534, 65535, 1, 0, 65535, 1000) {
+		events = append(events, tracker.Track(&p))
+	}
+	assert.Equal(t, []SeqEvent{SeqInOrder, SeqInOrder, SeqGap, SeqOutOfOrder, SeqDuplicate, SeqGap}, events, "invalid events")
+
+	p := makeSeqPackets(0, 2)[0]
+	assert.Equal(t, SeqStale, tracker.Track(&p), "beyond history must be stale")
+	assert.Equal(t, uint64(998), tracker.Stats(0).Lost, "invalid lost")
+}
+
+func TestSeqReaderReorder(t *testing.T) {
+	in := append(makeSeqPackets(0, 1, 3, 2, 2, 6, 5, 9), makeSeqPackets(1, 7, 8)...)
+	sr := NewSeqReader(&sliceReader{packets: in}, SeqConfig{ReorderWindow: 2})
+
+	var ids []uint32
+	for _, p := range readAllPackets(t, sr) {
+		if p.InterfaceIndex == 0 {
+			ids = append(ids, p.Id)
+		}
+	}
+	assert.Equal(t, []uint32{1, 2, 3, 5, 6, 9}, ids, "invalid order")
+	assert.Equal(t, uint64(1), sr.Tracker().Stats(0).Duplicates, "invalid duplicates")
+	assert.Equal(t, uint64(3), sr.Tracker().Stats(0).Lost, "invalid lost")
+}
@@ -0,0 +1,116 @@
+package pack
+
+import (
+	"errors"
+	"io"
+)
+
+// PacketReader reads packets one by one from a stream, returns io.EOF at the end.
+type PacketReader interface {
+	ReadPacket(p *CapturePacket) error
+}
+
+// PacketWriter writes packets one by one to a stream.
+type PacketWriter interface {
+	WritePacket(p *CapturePacket) error
+}
+
+// BinaryPackReader reads packets framed by BinaryPack from a byte stream,
+// the data length of each frame is taken from CaptureLength and checked
+// against Limits before it is read.
+type BinaryPackReader struct {
+	Limits
+	r    io.Reader
+	meta [CapturePacketMetaLen]byte
+}
+
+func NewBinaryPackReader(r io.Reader) *BinaryPackReader {
+	return &BinaryPackReader{r: r}
+}
+
+// Every packet gets its own Data, so packets can be kept after the next read.
+func (br *BinaryPackReader) ReadPacket(p *CapturePacket) error {
+	_, err := io.ReadFull(br.r, br.meta[:])
+	if err != nil {
+		return err
+	}
+	err = BinaryPack.DecodeMeta(br.meta[:], p)
+	if err != nil {
+		return err
+	}
+	err = br.CheckFrame(CapturePacketMetaLen + p.CaptureLength)
+	if err != nil {
+		return err
+	}
+
+	p.Data = make([]byte, p.CaptureLength)
+	_, err = io.ReadFull(br.r, p.Data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// BinaryPackWriter writes packets framed by BinaryPack to a byte stream.
+type BinaryPackWriter struct {
+	w io.Writer
+}
+
+func NewBinaryPackWriter(w io.Writer) *BinaryPackWriter {
+	return &BinaryPackWriter{w: w}
+}
+
+func (bw *BinaryPackWriter) WritePacket(p *CapturePacket) error {
+	// The reader relies on CaptureLength to find the end of the frame.
+	if p.CaptureLength != len(p.Data) || len(p.Data) > 0xffff {
+		return errors.New("invalid packet capture length")
+	}
+	_, err := BinaryPack.EncodeTo(p, bw.w)
+	return err
+}
+
+// Transformer rewrites a packet in place.
+type Transformer interface {
+	Transform(p *CapturePacket) error
+}
+
+type TransformFunc func(p *CapturePacket) error
+
+func (fn TransformFunc) Transform(p *CapturePacket) error { return fn(p) }
+
+type transformReader struct {
+	r PacketReader
+	t Transformer
+}
+
+// NewTransformReader applies t to every packet read from r.
+func NewTransformReader(r PacketReader, t Transformer) PacketReader {
+	return &transformReader{r: r, t: t}
+}
+
+func (tr *transformReader) ReadPacket(p *CapturePacket) error {
+	err := tr.r.ReadPacket(p)
+	if err != nil {
+		return err
+	}
+	return tr.t.Transform(p)
+}
+
+type transformWriter struct {
+	w PacketWriter
+	t Transformer
+}
+
+// NewTransformWriter applies t to every packet before writing it to w,
+// the packets passed in are modified.
+func NewTransformWriter(w PacketWriter, t Transformer) PacketWriter {
+	return &transformWriter{w: w, t: t}
+}
+
+func (tw *transformWriter) WritePacket(p *CapturePacket) error {
+	err := tw.t.Transform(p)
+	if err != nil {
+		return err
+	}
+	return tw.w.WritePacket(p)
+}
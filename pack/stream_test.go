@@ -0,0 +1,24 @@
+package pack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryPackStream(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := NewBinaryPackWriter(buf)
+	for _, p := range packets {
+		assert.NoError(t, w.WritePacket(&p), "write failed")
+	}
+	assert.Error(t, w.WritePacket(&CapturePacket{Data: []byte{1}}), "mismatched capture length")
+
+	ps := readAllPackets(t, NewBinaryPackReader(buf))
+	assert.Equal(t, len(packets), len(ps), "invalid packet count")
+	for i := range ps {
+		assert.Equal(t, packets[i].CaptureInfo, ps[i].CaptureInfo, "invalid capture info")
+		assert.Equal(t, packets[i].Data, ps[i].Data, "invalid data")
+	}
+}